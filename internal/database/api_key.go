@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"github.com/Mahider-T/autoSphere/validator"
+	"github.com/lib/pq"
+)
+
+const (
+	ScopeShopsRead       = "shops:read"
+	ScopeShopsWrite      = "shops:write"
+	ScopeCategoriesWrite = "categories:write"
+)
+
+var APIKeyScopes = []string{ScopeShopsRead, ScopeShopsWrite, ScopeCategoriesWrite}
+
+const apiKeyPrefix = "ask_"
+
+type APIKey struct {
+	Id         int64      `json:"id"`
+	UserId     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Plaintext  string     `json:"key,omitempty"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Expiry     *time.Time `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Created_At time.Time  `json:"created_at"`
+	// Role is the owning user's role. A key never grants more than its owner has.
+	Role   Role  `json:"-"`
+	RoleId int64 `json:"-"`
+}
+
+func ValidateAPIKey(v *validator.Validator, k *APIKey) {
+	v.Check(k.Name != "", "name", "name must not be empty")
+	v.Check(len(k.Name) <= 100, "name", "name must not be more than 100 bytes long")
+	v.Check(len(k.Scopes) > 0, "scopes", "at least one scope must be provided")
+	v.Check(validator.Unique(k.Scopes), "scopes", "scopes must not contain duplicates")
+	for _, scope := range k.Scopes {
+		v.Check(validator.In(scope, APIKeyScopes...), "scopes", "unknown scope "+scope)
+	}
+	if k.Expiry != nil {
+		v.Check(k.Expiry.After(time.Now()), "expiry", "expiry must be in the future")
+	}
+}
+
+type APIKeyModel struct {
+	db *sql.DB
+}
+
+// New generates the secret for k, stores its hash and leaves the plaintext on
+// k.Plaintext. It is never retrievable again.
+func (m APIKeyModel) New(k *APIKey) error {
+	randomBytes := make([]byte, 20)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return err
+	}
+	k.Plaintext = apiKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	k.Prefix = k.Plaintext[:len(apiKeyPrefix)+6]
+	hash := sha256.Sum256([]byte(k.Plaintext))
+
+	query := `
+	INSERT INTO api_keys (user_id, name, hash, prefix, scopes, expiry)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{k.UserId, k.Name, hash[:], k.Prefix, pq.Array(k.Scopes), k.Expiry}
+	return m.db.QueryRowContext(ctx, query, args...).Scan(&k.Id, &k.Created_At)
+}
+
+func (m APIKeyModel) GetAllForUser(userId int64) ([]APIKey, error) {
+	query := `
+	SELECT id, user_id, name, prefix, scopes, expiry, last_used_at, created_at
+	FROM api_keys
+	WHERE user_id = $1 AND revoked_at IS NULL
+	ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		err := rows.Scan(&k.Id, &k.UserId, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.Expiry, &k.LastUsedAt, &k.Created_At)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (m APIKeyModel) Revoke(userId, id int64) error {
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetForAuthentication looks up a live key by its plaintext and records the
+// use. last_used_at is only written once a minute to keep busy keys cheap.
+func (m APIKeyModel) GetForAuthentication(plaintext string) (*APIKey, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	query := `
+	SELECT api_keys.id, api_keys.user_id, api_keys.name, api_keys.prefix, api_keys.scopes, api_keys.expiry, users.role, roles.id
+	FROM api_keys
+	INNER JOIN users ON users.id = api_keys.user_id
+	INNER JOIN roles ON roles.name = users.role
+	WHERE api_keys.hash = $1 AND api_keys.revoked_at IS NULL
+	AND (api_keys.expiry IS NULL OR api_keys.expiry > NOW())`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var k APIKey
+	err := m.db.QueryRowContext(ctx, query, hash[:]).Scan(&k.Id, &k.UserId, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.Expiry, &k.Role, &k.RoleId)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+	UPDATE api_keys SET last_used_at = NOW()
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+	if _, err = m.db.ExecContext(ctx, query, k.Id); err != nil {
+		return nil, err
+	}
+
+	return &k, nil
+}
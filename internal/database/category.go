@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -11,50 +13,239 @@ type CategoryModel struct {
 	db *sql.DB
 }
 
+var (
+	ErrUnknownParentCategory = errors.New("unknown parent category")
+	ErrCategoryCycle         = errors.New("category cannot be moved below itself")
+	ErrCategoryHasChildren   = errors.New("category has child categories")
+)
+
+// Category is a node in the category tree. A nil ParentId means it is a
+// root. Label is Value translated into the requested locale.
 type Category struct {
-	Id    int
-	Value string
+	Id       int
+	Value    string
+	Slug     string
+	Label    string
+	ParentId *int
+}
+
+// CategoryNode is a category together with its members and subcategories,
+// as returned by Tree.
+type CategoryNode struct {
+	Id       int              `json:"id"`
+	Value    string           `json:"value"`
+	Slug     string           `json:"slug"`
+	Label    string           `json:"label"`
+	Members  []CategoryMember `json:"members"`
+	Children []*CategoryNode  `json:"children"`
 }
 
 func (cm CategoryModel) Create(cat *Category) error {
 
-	query := `INSERT INTO categories (value)
-			VALUES ($1)
-			RETURNING id, value`
+	query := `INSERT INTO categories (value, slug, parent_id, path)
+			VALUES ($1, $2, $3, '')
+			RETURNING id, value, slug, parent_id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 	args := []interface{}{
 		cat.Value,
+		cat.Slug,
+		cat.ParentId,
+	}
+
+	tx, err := cm.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&cat.Id, &cat.Value, &cat.Slug, &cat.ParentId)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "categories_parent_id_fkey"):
+			return ErrUnknownParentCategory
+		case strings.Contains(err.Error(), "categories_slug_key"):
+			return ErrDuplicateSlug
+		default:
+			return err
+		}
+	}
+	// A new category has no translations yet.
+	cat.Label = cat.Value
+
+	query = `UPDATE categories
+			SET path = COALESCE((SELECT path FROM categories WHERE id = $2), '') || text2ltree(id::text)
+			WHERE id = $1`
+
+	if _, err = tx.ExecContext(ctx, query, cat.Id, cat.ParentId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Move reparents the category, and with it its whole subtree, below
+// parentId, or makes it a root when parentId is nil. Moving a category below
+// itself or one of its descendants is rejected with ErrCategoryCycle.
+func (cm CategoryModel) Move(id int64, parentId *int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := cm.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var path string
+	err = tx.QueryRowContext(ctx, `SELECT path FROM categories WHERE id = $1 FOR UPDATE`, id).Scan(&path)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	parentPath := ""
+	if parentId != nil {
+		var cycle bool
+		query := `SELECT path, path <@ $2::ltree FROM categories WHERE id = $1 FOR UPDATE`
+		err = tx.QueryRowContext(ctx, query, *parentId, path).Scan(&parentPath, &cycle)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrUnknownParentCategory
+			default:
+				return err
+			}
+		}
+		if cycle {
+			return ErrCategoryCycle
+		}
+	}
+
+	// Swap the old path prefix for the new one on the category and every
+	// descendant.
+	query := `UPDATE categories
+			SET path = $2::ltree || subpath(path, nlevel($1::ltree) - 1)
+			WHERE path <@ $1::ltree`
+
+	if _, err = tx.ExecContext(ctx, query, path, parentPath); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE categories SET parent_id = $2 WHERE id = $1`, id, parentId); err != nil {
+		return err
 	}
-	return cm.db.QueryRowContext(ctx, query, args...).Scan(&cat.Id, &cat.Value)
+
+	return tx.Commit()
 }
 
-func (cm CategoryModel) Put(cat *Category) error {
-	query := `UPDATE categories SET value=$1
-			WHERE id=$2 
-			RETURNING id, value`
+// Tree returns every category as a forest of root categories, each with its
+// members and subcategories ordered by label.
+func (cm CategoryModel) Tree(locale string) ([]*CategoryNode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Ordering by path puts every parent before its children.
+	query := `SELECT id, value, slug, ` + categoryLabel("$1") + `, parent_id FROM categories ORDER BY path`
+	rows, err := cm.db.QueryContext(ctx, query, locale)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roots := []*CategoryNode{}
+	nodes := map[int]*CategoryNode{}
+	for rows.Next() {
+		var parentId *int
+		node := &CategoryNode{Members: []CategoryMember{}, Children: []*CategoryNode{}}
+		if err := rows.Scan(&node.Id, &node.Value, &node.Slug, &node.Label, &parentId); err != nil {
+			return nil, err
+		}
+		nodes[node.Id] = node
+		if parentId != nil {
+			if parent, ok := nodes[*parentId]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT id, value, slug, ` + categoryMemberLabel("$1") + ` AS label, category_id FROM category_members ORDER BY label`
+	rows, err = cm.db.QueryContext(ctx, query, locale)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var member CategoryMember
+		if err := rows.Scan(&member.Id, &member.Value, &member.Slug, &member.Label, &member.CategoryId); err != nil {
+			return nil, err
+		}
+		if node, ok := nodes[member.CategoryId]; ok {
+			node.Members = append(node.Members, member)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sortCategoryNodes(roots)
+	return roots, nil
+}
+
+func sortCategoryNodes(nodes []*CategoryNode) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Label < nodes[j].Label })
+	for _, node := range nodes {
+		sortCategoryNodes(node.Children)
+	}
+}
+
+func (cm CategoryModel) Put(cat *Category, locale string) error {
+	query := `UPDATE categories SET value=$1, slug=$2
+			WHERE id=$3 
+			RETURNING id, value, slug, ` + categoryLabel("$4") + `, parent_id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 	args := []interface{}{
 		cat.Value,
+		cat.Slug,
 		cat.Id,
+		locale,
 	}
 
-	return cm.db.QueryRowContext(ctx, query, args...).Scan(&cat.Id, &cat.Value)
+	err := cm.db.QueryRowContext(ctx, query, args...).Scan(&cat.Id, &cat.Value, &cat.Slug, &cat.Label, &cat.ParentId)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "categories_slug_key"):
+			return ErrDuplicateSlug
+		default:
+			return err
+		}
+	}
+	return nil
 }
-func (cm CategoryModel) Get(id int64) (*Category, error) {
+func (cm CategoryModel) Get(id int64, locale string) (*Category, error) {
 
-	query := `Select id, value FROM categories
+	query := `Select id, value, slug, ` + categoryLabel("$2") + `, parent_id FROM categories
 			  WHERE id=$1`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 	var cat Category
-	err := cm.db.QueryRowContext(ctx, query, id).Scan(&cat.Id, &cat.Value)
+	err := cm.db.QueryRowContext(ctx, query, id, locale).Scan(&cat.Id, &cat.Value, &cat.Slug, &cat.Label, &cat.ParentId)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -66,14 +257,14 @@ func (cm CategoryModel) Get(id int64) (*Category, error) {
 	return &cat, nil
 }
 
-func (cm CategoryModel) GetAll() ([]Category, int, error) {
+func (cm CategoryModel) GetAll(locale string) ([]Category, int, error) {
 
-	query := `SELECT count(*) OVER(), id, value FROM categories;`
+	query := `SELECT count(*) OVER(), id, value, slug, ` + categoryLabel("$1") + `, parent_id FROM categories ORDER BY path;`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 
 	defer cancel()
 
-	rows, err := cm.db.QueryContext(ctx, query)
+	rows, err := cm.db.QueryContext(ctx, query, locale)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, 0, ErrRecordNotFound
@@ -89,6 +280,9 @@ func (cm CategoryModel) GetAll() ([]Category, int, error) {
 			&totalAmount,
 			&category.Id,
 			&category.Value,
+			&category.Slug,
+			&category.Label,
+			&category.ParentId,
 		)
 		if err != nil {
 			return nil, 0, err
@@ -106,7 +300,12 @@ func (cm CategoryModel) Delete(id int64) error {
 
 	result, err := cm.db.ExecContext(ctx, query, id)
 	if err != nil {
-		return err
+		switch {
+		case strings.Contains(err.Error(), "categories_parent_id_fkey"):
+			return ErrCategoryHasChildren
+		default:
+			return err
+		}
 	}
 
 	rowsAffected, err := result.RowsAffected()
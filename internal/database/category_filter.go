@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Mahider-T/autoSphere/validator"
+	"github.com/lib/pq"
+)
+
+// CategoryClause is one category of a category filter expression such as
+// brand:toyota|nissan,service:*tires*brakes|!towing. Categories and values
+// are slugs, lowercased when parsed. A shop satisfies the clause when it
+// carries at least one AnyOf member, every AllOf member and none of the
+// NoneOf members from that category or its subcategories.
+type CategoryClause struct {
+	Category string
+	AnyOf    []string
+	AllOf    []string
+	NoneOf   []string
+}
+
+func (c CategoryClause) values() []string {
+	values := append([]string{}, c.AnyOf...)
+	values = append(values, c.AllOf...)
+	return append(values, c.NoneOf...)
+}
+
+const (
+	maxCategoryClauses      = 10
+	maxCategoryClauseValues = 20
+)
+
+// ParseCategoryClauses parses a category filter expression. Clauses are
+// separated by ",", the category from its values by ":" and the values by
+// "|". A value starting with "!" excludes shops carrying it, and one starting
+// with "*" lists values separated by "*" that a shop must all carry, e.g.
+// brand:*toyota*nissan. Every separator and marker passes through query
+// strings unchanged; "+" would decode to a space and Go drops parameters
+// containing ";". Problems are recorded on v under key.
+func ParseCategoryClauses(v *validator.Validator, key string, s string) []CategoryClause {
+	clauses := []CategoryClause{}
+
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		category, values, found := strings.Cut(part, ":")
+		category = strings.ToLower(strings.TrimSpace(category))
+		if !found || category == "" {
+			v.AddError(key, "clauses must be written as category:value|value")
+			return nil
+		}
+
+		clause := CategoryClause{Category: category}
+		for _, value := range strings.Split(values, "|") {
+			value = strings.ToLower(strings.TrimSpace(value))
+
+			switch {
+			case strings.HasPrefix(value, "!"):
+				value = strings.TrimSpace(strings.TrimPrefix(value, "!"))
+				if value == "" {
+					v.AddError(key, "values must not be empty")
+					return nil
+				}
+				clause.NoneOf = append(clause.NoneOf, value)
+			case strings.HasPrefix(value, "*"):
+				for _, required := range strings.Split(strings.TrimPrefix(value, "*"), "*") {
+					required = strings.TrimSpace(required)
+					if required == "" {
+						v.AddError(key, "values must not be empty")
+						return nil
+					}
+					clause.AllOf = append(clause.AllOf, required)
+				}
+			default:
+				if value == "" {
+					v.AddError(key, "values must not be empty")
+					return nil
+				}
+				clause.AnyOf = append(clause.AnyOf, value)
+			}
+		}
+
+		v.Check(len(clause.values()) <= maxCategoryClauseValues, key, fmt.Sprintf("must not have more than %d values per category", maxCategoryClauseValues))
+		clauses = append(clauses, clause)
+	}
+
+	v.Check(len(clauses) <= maxCategoryClauses, key, fmt.Sprintf("must not have more than %d categories", maxCategoryClauses))
+	return clauses
+}
+
+// UnknownClauseValues returns the category:value pairs of clauses that don't
+// name a member of the category or its subcategories, including every value
+// of a category that doesn't exist. Filtering on them would otherwise
+// silently match no shops, or every shop for exclusions.
+func (cm CategoryModel) UnknownClauseValues(clauses []CategoryClause) ([]string, error) {
+	categories, values := []string{}, []string{}
+	for _, clause := range clauses {
+		for _, value := range clause.values() {
+			categories = append(categories, clause.Category)
+			values = append(values, value)
+		}
+	}
+
+	if len(values) == 0 {
+		return []string{}, nil
+	}
+
+	query := `
+	SELECT refs.category || ':' || refs.value
+	FROM unnest($1::text[], $2::text[]) WITH ORDINALITY AS refs(category, value, n)
+	WHERE NOT EXISTS (
+		SELECT 1
+		FROM category_members
+		INNER JOIN categories ON category_members.category_id = categories.id
+		WHERE category_members.slug = refs.value
+		AND categories.path <@ ARRAY(SELECT path FROM categories WHERE slug = refs.category))
+	ORDER BY refs.n`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := cm.db.QueryContext(ctx, query, pq.Array(categories), pq.Array(values))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unknown := []string{}
+	for rows.Next() {
+		var ref string
+		if err := rows.Scan(&ref); err != nil {
+			return nil, err
+		}
+		unknown = append(unknown, ref)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return unknown, nil
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+func TestParseCategoryClauses(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		clauses []CategoryClause
+	}{
+		{"empty", "", []CategoryClause{}},
+		{"only separators", " , ,", []CategoryClause{}},
+		{"any of", "brand:toyota|nissan", []CategoryClause{{Category: "brand", AnyOf: []string{"toyota", "nissan"}}}},
+		{"none of", "service:!towing", []CategoryClause{{Category: "service", NoneOf: []string{"towing"}}}},
+		{"all of", "service:*tires*brakes", []CategoryClause{{Category: "service", AllOf: []string{"tires", "brakes"}}}},
+		{"all of as separate values", "service:*tires|*brakes", []CategoryClause{{Category: "service", AllOf: []string{"tires", "brakes"}}}},
+		{
+			"mixed",
+			"service:oil|*tires|!towing",
+			[]CategoryClause{{Category: "service", AnyOf: []string{"oil"}, AllOf: []string{"tires"}, NoneOf: []string{"towing"}}},
+		},
+		{
+			"several clauses",
+			"brand:toyota,service:!towing",
+			[]CategoryClause{{Category: "brand", AnyOf: []string{"toyota"}}, {Category: "service", NoneOf: []string{"towing"}}},
+		},
+		{
+			"whitespace and case",
+			" Brand : Toyota | ! Towing , service : * Tires * Brakes ",
+			[]CategoryClause{
+				{Category: "brand", AnyOf: []string{"toyota"}, NoneOf: []string{"towing"}},
+				{Category: "service", AllOf: []string{"tires", "brakes"}},
+			},
+		},
+		{"repeated category", "brand:toyota,brand:nissan", []CategoryClause{{Category: "brand", AnyOf: []string{"toyota"}}, {Category: "brand", AnyOf: []string{"nissan"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			clauses := ParseCategoryClauses(v, "category_filter", tt.input)
+			if !v.Valid() {
+				t.Fatalf("unexpected errors %v", v.Errors)
+			}
+			if !reflect.DeepEqual(clauses, tt.clauses) {
+				t.Errorf("expected %+v, got %+v", tt.clauses, clauses)
+			}
+		})
+	}
+}
+
+func TestParseCategoryClausesRejects(t *testing.T) {
+	values := func(n int) string {
+		vs := make([]string, n)
+		for i := range vs {
+			vs[i] = "v"
+		}
+		return strings.Join(vs, "|")
+	}
+	clauses := func(n int) string {
+		cs := make([]string, n)
+		for i := range cs {
+			cs[i] = "brand:toyota"
+		}
+		return strings.Join(cs, ",")
+	}
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing colon", "brand"},
+		{"missing category", ":toyota"},
+		{"empty value", "brand:toyota||nissan"},
+		{"no values", "brand:"},
+		{"empty exclusion", "brand:!"},
+		{"empty requirement", "brand:*"},
+		{"empty requirement in a list", "brand:*toyota**nissan"},
+		{"too many values", "brand:" + values(maxCategoryClauseValues+1)},
+		{"too many values across kinds", "brand:" + values(maxCategoryClauseValues) + "|!other"},
+		{"too many clauses", clauses(maxCategoryClauses + 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ParseCategoryClauses(v, "category_filter", tt.input)
+			if v.Valid() {
+				t.Errorf("expected %q to be rejected", tt.input)
+			}
+		})
+	}
+
+	t.Run("at the limits", func(t *testing.T) {
+		v := validator.New()
+		ParseCategoryClauses(v, "category_filter", "brand:"+values(maxCategoryClauseValues))
+		ParseCategoryClauses(v, "category_filter", clauses(maxCategoryClauses))
+		if !v.Valid() {
+			t.Errorf("unexpected errors %v", v.Errors)
+		}
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -12,47 +13,71 @@ type CategoryMemberModel struct {
 	db *sql.DB
 }
 
+// CategoryMember is a value shops can be tagged with. Label is Value
+// translated into the requested locale.
 type CategoryMember struct {
 	Id         int    `json:"id"`
 	Value      string `json:"value"`
+	Slug       string `json:"slug"`
+	Label      string `json:"label"`
 	CategoryId int    `json:"category_id"`
 }
 
 func (cmm CategoryMemberModel) Create(cm *CategoryMember) error {
 	fmt.Print("The CM !! ", cm.CategoryId, "  !!")
-	query := `INSERT INTO category_members (value, category_id)
-			VALUES ($1,$2)
-			RETURNING id, value, category_id`
+	query := `INSERT INTO category_members (value, slug, category_id)
+			VALUES ($1,$2,$3)
+			RETURNING id, value, slug, category_id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{cm.Value, cm.CategoryId}
-	return cmm.db.QueryRowContext(ctx, query, args...).Scan(&cm.Id, &cm.Value, &cm.CategoryId)
+	args := []interface{}{cm.Value, cm.Slug, cm.CategoryId}
+	err := cmm.db.QueryRowContext(ctx, query, args...).Scan(&cm.Id, &cm.Value, &cm.Slug, &cm.CategoryId)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "category_members_category_id_slug_key"):
+			return ErrDuplicateSlug
+		default:
+			return err
+		}
+	}
+	// A new member has no translations yet.
+	cm.Label = cm.Value
+	return nil
 }
 
-func (cmm CategoryMemberModel) Patch(cm *CategoryMember) error {
+func (cmm CategoryMemberModel) Patch(cm *CategoryMember, locale string) error {
 	query := `UPDATE category_members 
-			SET value=$1, category_id=$2 
-			WHERE id=$3 
-			RETURNING id, value, category_id`
+			SET value=$1, slug=$2, category_id=$3 
+			WHERE id=$4 
+			RETURNING id, value, slug, ` + categoryMemberLabel("$5") + `, category_id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{cm.Value, cm.CategoryId, cm.Id}
-	return cmm.db.QueryRowContext(ctx, query, args...).Scan(&cm.Id, &cm.Value, &cm.CategoryId)
+	args := []interface{}{cm.Value, cm.Slug, cm.CategoryId, cm.Id, locale}
+	err := cmm.db.QueryRowContext(ctx, query, args...).Scan(&cm.Id, &cm.Value, &cm.Slug, &cm.Label, &cm.CategoryId)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "category_members_category_id_slug_key"):
+			return ErrDuplicateSlug
+		default:
+			return err
+		}
+	}
+	return nil
 }
 
-func (cmm CategoryMemberModel) Get(id int64) (*CategoryMember, error) {
-	query := `SELECT id, value, category_id FROM category_members
+func (cmm CategoryMemberModel) Get(id int64, locale string) (*CategoryMember, error) {
+	query := `SELECT id, value, slug, ` + categoryMemberLabel("$2") + `, category_id FROM category_members
 			  WHERE id=$1`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var cm CategoryMember
-	err := cmm.db.QueryRowContext(ctx, query, id).Scan(&cm.Id, &cm.Value, &cm.CategoryId)
+	err := cmm.db.QueryRowContext(ctx, query, id, locale).Scan(&cm.Id, &cm.Value, &cm.Slug, &cm.Label, &cm.CategoryId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
@@ -63,13 +88,13 @@ func (cmm CategoryMemberModel) Get(id int64) (*CategoryMember, error) {
 	return &cm, nil
 }
 
-func (cmm CategoryMemberModel) GetAll() ([]CategoryMember, int, error) {
-	query := `SELECT count(*) OVER(), id, value, category_id FROM category_members;`
+func (cmm CategoryMemberModel) GetAll(locale string) ([]CategoryMember, int, error) {
+	query := `SELECT count(*) OVER(), id, value, slug, ` + categoryMemberLabel("$1") + `, category_id FROM category_members;`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := cmm.db.QueryContext(ctx, query)
+	rows, err := cmm.db.QueryContext(ctx, query, locale)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, 0, ErrRecordNotFound
@@ -85,6 +110,8 @@ func (cmm CategoryMemberModel) GetAll() ([]CategoryMember, int, error) {
 			&totalAmount,
 			&cm.Id,
 			&cm.Value,
+			&cm.Slug,
+			&cm.Label,
 			&cm.CategoryId,
 		)
 		if err != nil {
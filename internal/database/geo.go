@@ -0,0 +1,93 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+// BoundingBox is a map viewport in WGS 84 degrees. A viewport that crosses
+// the antimeridian has MinLng greater than MaxLng, e.g. 170,-20,-170,20.
+type BoundingBox struct {
+	MinLng float64
+	MinLat float64
+	MaxLng float64
+	MaxLat float64
+}
+
+func ValidateBoundingBox(v *validator.Validator, key string, b BoundingBox) {
+	v.Check(b.MinLng >= -180 && b.MinLng <= 180 && b.MaxLng >= -180 && b.MaxLng <= 180, key, "longitudes must be between -180 and 180")
+	v.Check(b.MinLat >= -90 && b.MaxLat <= 90, key, "latitudes must be between -90 and 90")
+	v.Check(b.MinLat <= b.MaxLat, key, "minLat must not be greater than maxLat")
+}
+
+// Envelopes splits a viewport that crosses the antimeridian into the parts
+// east and west of it, since PostGIS envelopes can't wrap around.
+func (b BoundingBox) Envelopes() []BoundingBox {
+	if b.MinLng <= b.MaxLng {
+		return []BoundingBox{b}
+	}
+	return []BoundingBox{
+		{MinLng: b.MinLng, MinLat: b.MinLat, MaxLng: 180, MaxLat: b.MaxLat},
+		{MinLng: -180, MinLat: b.MinLat, MaxLng: b.MaxLng, MaxLat: b.MaxLat},
+	}
+}
+
+// Geometry is a GeoJSON geometry object. Only the polygon types are accepted
+// for area searches; the original JSON is handed to PostGIS as is.
+type Geometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// Upper bound on the number of positions in a search area, to keep the
+// containment test cheap.
+const maxGeometryPositions = 5000
+
+func ValidateGeometry(v *validator.Validator, key string, g Geometry) {
+	var polygons [][][][2]float64
+
+	switch g.Type {
+	case "Polygon":
+		var polygon [][][2]float64
+		if err := json.Unmarshal(g.Coordinates, &polygon); err != nil {
+			v.AddError(key, "coordinates must be an array of linear rings")
+			return
+		}
+		polygons = append(polygons, polygon)
+	case "MultiPolygon":
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			v.AddError(key, "coordinates must be an array of polygons")
+			return
+		}
+	default:
+		v.AddError(key, "type must be Polygon or MultiPolygon")
+		return
+	}
+
+	v.Check(len(polygons) > 0, key, "must contain at least one polygon")
+
+	positions := 0
+	for i, polygon := range polygons {
+		if len(polygon) == 0 {
+			v.AddError(key, fmt.Sprintf("polygon %d has no rings", i))
+			return
+		}
+		for _, ring := range polygon {
+			positions += len(ring)
+			if len(ring) < 4 || ring[0] != ring[len(ring)-1] {
+				v.AddError(key, "linear rings must be closed and have at least four positions")
+				return
+			}
+			for _, position := range ring {
+				if position[0] < -180 || position[0] > 180 || position[1] < -90 || position[1] > 90 {
+					v.AddError(key, "positions must be [longitude, latitude] within range")
+					return
+				}
+			}
+		}
+	}
+
+	v.Check(positions <= maxGeometryPositions, key, fmt.Sprintf("must not have more than %d positions", maxGeometryPositions))
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+func TestValidateBoundingBox(t *testing.T) {
+	tests := []struct {
+		name  string
+		bbox  BoundingBox
+		valid bool
+	}{
+		{"viewport", BoundingBox{38.6, 8.8, 38.9, 9.1}, true},
+		{"whole world", BoundingBox{-180, -90, 180, 90}, true},
+		{"crosses the antimeridian", BoundingBox{170, -20, -170, 20}, true},
+		{"longitude out of range", BoundingBox{-181, 0, 10, 10}, false},
+		{"crossing longitude out of range", BoundingBox{190, 0, -170, 10}, false},
+		{"latitude out of range", BoundingBox{0, -91, 10, 10}, false},
+		{"latitudes swapped", BoundingBox{0, 10, 10, 0}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateBoundingBox(v, "bbox", tt.bbox)
+			if v.Valid() != tt.valid {
+				t.Errorf("expected valid=%t, got errors %v", tt.valid, v.Errors)
+			}
+		})
+	}
+}
+
+func TestBoundingBoxEnvelopes(t *testing.T) {
+	tests := []struct {
+		name string
+		bbox BoundingBox
+		want []BoundingBox
+	}{
+		{
+			"viewport",
+			BoundingBox{38.6, 8.8, 38.9, 9.1},
+			[]BoundingBox{{38.6, 8.8, 38.9, 9.1}},
+		},
+		{
+			"crosses the antimeridian",
+			BoundingBox{170, -20, -170, 20},
+			[]BoundingBox{{170, -20, 180, 20}, {-180, -20, -170, 20}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.bbox.Envelopes()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateGeometry(t *testing.T) {
+	square := `[[[38.7, 9.0], [38.8, 9.0], [38.8, 9.1], [38.7, 9.1], [38.7, 9.0]]]`
+
+	tests := []struct {
+		name     string
+		geometry string
+		valid    bool
+	}{
+		{"polygon", `{"type": "Polygon", "coordinates": ` + square + `}`, true},
+		{"multipolygon", `{"type": "MultiPolygon", "coordinates": [` + square + `, ` + square + `]}`, true},
+		{"point", `{"type": "Point", "coordinates": [38.7, 9.0]}`, false},
+		{"malformed coordinates", `{"type": "Polygon", "coordinates": [38.7, 9.0]}`, false},
+		{"empty multipolygon", `{"type": "MultiPolygon", "coordinates": []}`, false},
+		{"polygon without rings", `{"type": "MultiPolygon", "coordinates": [[]]}`, false},
+		{"open ring", `{"type": "Polygon", "coordinates": [[[38.7, 9.0], [38.8, 9.0], [38.8, 9.1], [38.7, 9.1]]]}`, false},
+		{"too few positions", `{"type": "Polygon", "coordinates": [[[38.7, 9.0], [38.8, 9.0], [38.7, 9.0]]]}`, false},
+		{"latitude first", `{"type": "Polygon", "coordinates": [[[9.0, 138.7], [9.0, 138.8], [9.1, 138.8], [9.0, 138.7]]]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var g Geometry
+			if err := json.Unmarshal([]byte(tt.geometry), &g); err != nil {
+				t.Fatalf("decoding geometry: %v", err)
+			}
+
+			v := validator.New()
+			ValidateGeometry(v, "within", g)
+			if v.Valid() != tt.valid {
+				t.Errorf("expected valid=%t, got errors %v", tt.valid, v.Errors)
+			}
+		})
+	}
+}
+
+func TestValidateGeometryLimitsPositions(t *testing.T) {
+	ring := make([][2]float64, 0, maxGeometryPositions+1)
+	for i := 0; i < maxGeometryPositions; i++ {
+		ring = append(ring, [2]float64{float64(i%360) - 180, float64(i%180) - 90})
+	}
+	ring = append(ring, ring[0])
+
+	coordinates, err := json.Marshal([][][2]float64{ring})
+	if err != nil {
+		t.Fatalf("encoding ring: %v", err)
+	}
+
+	v := validator.New()
+	ValidateGeometry(v, "within", Geometry{Type: "Polygon", Coordinates: coordinates})
+	if v.Valid() {
+		t.Errorf("expected more than %d positions to be rejected", maxGeometryPositions)
+	}
+}
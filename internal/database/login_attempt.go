@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// Failures allowed before the first lockout. Every failure past the
+	// threshold doubles the lockout, up to a day.
+	AccountLockThreshold = 5
+	IPLockThreshold      = 20
+)
+
+func AccountAttemptKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+func IPAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+type LoginAttemptModel struct {
+	db *sql.DB
+}
+
+// LockedUntil returns the latest lockout among the given keys, or the zero
+// time if none of them is locked.
+func (m LoginAttemptModel) LockedUntil(keys ...string) (time.Time, error) {
+	query := `
+	SELECT COALESCE(MAX(locked_until), 'epoch')
+	FROM login_attempts
+	WHERE key = ANY($1) AND locked_until > NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var lockedUntil time.Time
+	err := m.db.QueryRowContext(ctx, query, pq.Array(keys)).Scan(&lockedUntil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !lockedUntil.After(time.Now()) {
+		return time.Time{}, nil
+	}
+	return lockedUntil, nil
+}
+
+// RecordFailure counts a failed login against key. Counters older than a day
+// start over.
+func (m LoginAttemptModel) RecordFailure(key string, threshold int) error {
+	query := `
+	INSERT INTO login_attempts AS la (key, failures, last_failed_at)
+	VALUES ($1, 1, NOW())
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE WHEN la.last_failed_at < NOW() - INTERVAL '24 hours' THEN 1 ELSE la.failures + 1 END,
+		last_failed_at = NOW()
+	RETURNING failures`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var failures int
+	if err := m.db.QueryRowContext(ctx, query, key).Scan(&failures); err != nil {
+		return err
+	}
+
+	if failures < threshold {
+		return nil
+	}
+
+	query = `
+	UPDATE login_attempts
+	SET locked_until = NOW() + LEAST(INTERVAL '1 minute' * POWER(2, $2), INTERVAL '24 hours')
+	WHERE key = $1`
+	_, err := m.db.ExecContext(ctx, query, key, min(failures-threshold, 20))
+	return err
+}
+
+func (m LoginAttemptModel) Reset(key string) error {
+	query := `DELETE FROM login_attempts WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.db.ExecContext(ctx, query, key)
+	return err
+}
@@ -0,0 +1,250 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+type TOTP struct {
+	Secret   []byte
+	Enabled  bool
+	LastStep int64
+}
+
+type MFAModel struct {
+	db *sql.DB
+}
+
+func (m MFAModel) GetTOTP(userId int64) (*TOTP, error) {
+	query := `SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var t TOTP
+	err := m.db.QueryRowContext(ctx, query, userId).Scan(&t.Secret, &t.Enabled, &t.LastStep)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// SetPendingTOTP stores a new secret that only takes effect once EnableTOTP
+// confirms the user can produce codes for it.
+func (m MFAModel) SetPendingTOTP(userId int64, secret []byte) error {
+	query := `UPDATE users SET totp_secret = $1, totp_last_step = 0 WHERE id = $2 AND totp_enabled = false`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, secret, userId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// EnableTOTP turns on the pending secret and issues the first set of recovery
+// codes in the same transaction, so MFA is never on without a way back in.
+// It returns the plaintext recovery codes.
+func (m MFAModel) EnableTOTP(userId int64, step int64) ([]string, error) {
+	query := `UPDATE users SET totp_enabled = true, totp_last_step = $1 WHERE id = $2 AND totp_secret IS NOT NULL AND totp_enabled = false`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, step, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseTOTPStep records step as consumed. It returns false if the step (or a
+// later one) was already used, which means the code is being replayed.
+func (m MFAModel) UseTOTPStep(userId int64, step int64) (bool, error) {
+	query := `UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, step, userId)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// NewRecoveryCodes replaces the user's recovery codes and returns the new
+// plaintext codes. Only their hashes are stored. It returns ErrRecordNotFound
+// unless the user has TOTP enabled.
+func (m MFAModel) NewRecoveryCodes(userId int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the user row so a concurrent DisableTOTP can't leave codes behind.
+	var enabled bool
+	err = tx.QueryRowContext(ctx, `SELECT totp_enabled FROM users WHERE id = $1 FOR UPDATE`, userId).Scan(&enabled)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if !enabled {
+		return nil, ErrRecordNotFound
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns TOTP off, forgets the secret and deletes the user's
+// recovery codes. It returns ErrRecordNotFound if TOTP wasn't enabled.
+func (m MFAModel) DisableTOTP(userId int64) error {
+	query := `UPDATE users SET totp_enabled = false, totp_secret = NULL, totp_last_step = 0 WHERE id = $1 AND totp_enabled = true`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// replaceRecoveryCodes swaps the user's recovery codes for new ones as part of
+// tx and returns the plaintext codes.
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userId int64) ([]string, error) {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userId); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		randomBytes := make([]byte, 10)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return nil, err
+		}
+		code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+		codes[i] = code[:8] + "-" + code[8:]
+
+		hash := sha256.Sum256([]byte(code))
+		_, err := tx.ExecContext(ctx, `INSERT INTO recovery_codes (hash, user_id) VALUES ($1, $2)`, hash[:], userId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode burns one recovery code. Dashes and case are ignored.
+func (m MFAModel) UseRecoveryCode(userId int64, code string) error {
+	code = strings.ToUpper(strings.ReplaceAll(code, "-", ""))
+	hash := sha256.Sum256([]byte(code))
+
+	query := `UPDATE recovery_codes SET used_at = NOW() WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, userId, hash[:])
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
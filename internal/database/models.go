@@ -16,6 +16,14 @@ type Models struct {
 	CategoryMember CategoryMemberModel
 	ShopCategory   ShopCategoryModel
 	Tokens         TokenModel
+	Sessions       SessionModel
+	LoginAttempts  LoginAttemptModel
+	MFA            MFAModel
+	APIKeys        APIKeyModel
+	Roles          RoleModel
+	Moderation     ModerationModel
+	ShopHours      ShopHoursModel
+	Search         SearchModel
 }
 
 func NewModels(db *sql.DB) Models {
@@ -26,5 +34,13 @@ func NewModels(db *sql.DB) Models {
 		CategoryMember: CategoryMemberModel{db: db},
 		ShopCategory:   ShopCategoryModel{db: db},
 		Tokens:         TokenModel{db: db},
+		Sessions:       SessionModel{db: db},
+		LoginAttempts:  LoginAttemptModel{db: db},
+		MFA:            MFAModel{db: db},
+		APIKeys:        APIKeyModel{db: db},
+		Roles:          RoleModel{db: db},
+		Moderation:     ModerationModel{db: db},
+		ShopHours:      ShopHoursModel{db: db},
+		Search:         SearchModel{db: db},
 	}
 }
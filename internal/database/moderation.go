@@ -0,0 +1,202 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrShopNotPending = errors.New("shop not pending")
+)
+
+// QueuedShop is a pending shop as shown in the moderation queue.
+type QueuedShop struct {
+	Shop
+	Submitted_At  time.Time  `json:"submitted_at"`
+	Claimed_By    *int64     `json:"claimed_by"`
+	Claimed_Until *time.Time `json:"claimed_until"`
+}
+
+// ModerationClaim is a reviewer's time limited lock on a pending shop.
+type ModerationClaim struct {
+	ShopId        int64     `json:"shop_id"`
+	Claimed_By    int64     `json:"claimed_by"`
+	Claimed_Until time.Time `json:"claimed_until"`
+}
+
+type ModerationStats struct {
+	Pending           int        `json:"pending"`
+	Claimed           int        `json:"claimed"`
+	OldestSubmittedAt *time.Time `json:"oldest_submitted_at"`
+	MedianWaitSeconds float64    `json:"median_wait_seconds"`
+}
+
+type ModerationModel struct {
+	db *sql.DB
+}
+
+// Queue lists pending shops oldest submission first, with categories labelled
+// for locale. With unclaimedOnly set, shops another reviewer is currently
+// working on are left out.
+func (m ModerationModel) Queue(unclaimedOnly bool, locale string, filters Filters) ([]QueuedShop, Metadata, error) {
+	query := `
+	SELECT count(*) OVER(), id, name, phone_number, email, location, ST_Y(coordinate::geometry), ST_X(coordinate::geometry), thumbnail, photos,
+		created_at, approval_status, created_by, ` + shopCategoriesColumn("$4") + `, submitted_at, claimed_by, claimed_until
+	FROM shops
+	WHERE approval_status = 'PENDING'
+	AND (NOT $1 OR claimed_until IS NULL OR claimed_until < NOW())
+	ORDER BY submitted_at ASC, id ASC
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, unclaimedOnly, filters.limit(), filters.offset(), locale)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	shops := []QueuedShop{}
+	for rows.Next() {
+		var shop QueuedShop
+		err := rows.Scan(
+			&totalRecords,
+			&shop.Id,
+			&shop.Name,
+			&shop.Phone_Number,
+			&shop.Email,
+			&shop.Location,
+			&shop.Latitude,
+			&shop.Longitude,
+			&shop.Thumbnail,
+			pq.Array(&shop.Photos),
+			&shop.Created_At,
+			&shop.Approval_Status,
+			&shop.Created_By,
+			&shop.Categories,
+			&shop.Submitted_At,
+			&shop.Claimed_By,
+			&shop.Claimed_Until,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		// An expired claim is as good as none.
+		if shop.Claimed_Until != nil && shop.Claimed_Until.Before(time.Now()) {
+			shop.Claimed_By, shop.Claimed_Until = nil, nil
+		}
+		shops = append(shops, shop)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := filters.calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return shops, metadata, nil
+}
+
+// Claim locks a pending shop for the reviewer for ttl. Claiming a shop the
+// reviewer already holds extends the claim. SKIP LOCKED means a shop that is
+// being claimed or decided concurrently is treated as taken rather than
+// waited on.
+func (m ModerationModel) Claim(shopId, reviewerId int64, ttl time.Duration) (*ModerationClaim, error) {
+	query := `
+	UPDATE shops SET claimed_by = $2, claimed_until = NOW() + $3 * INTERVAL '1 second'
+	WHERE id = (
+		SELECT id FROM shops
+		WHERE id = $1 AND approval_status = 'PENDING'
+		AND (claimed_until IS NULL OR claimed_until < NOW() OR claimed_by = $2)
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING claimed_until`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	claim := &ModerationClaim{ShopId: shopId, Claimed_By: reviewerId}
+	err := m.db.QueryRowContext(ctx, query, shopId, reviewerId, int64(ttl.Seconds())).Scan(&claim.Claimed_Until)
+	if err == nil {
+		return claim, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// Work out why nothing was claimed.
+	var status ShopApprovalStatus
+	err = m.db.QueryRowContext(ctx, `SELECT approval_status FROM shops WHERE id = $1`, shopId).Scan(&status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if status != PENDING {
+		return nil, ErrShopNotPending
+	}
+	return nil, ErrShopClaimed
+}
+
+// Release gives up the reviewer's claim without deciding on the shop.
+func (m ModerationModel) Release(shopId, reviewerId int64) error {
+	query := `
+	UPDATE shops SET claimed_by = NULL, claimed_until = NULL
+	WHERE id = $1 AND claimed_by = $2 AND claimed_until > NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, shopId, reviewerId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// HoldsClaim reports whether the reviewer has a live claim on the shop.
+func (m ModerationModel) HoldsClaim(shopId, reviewerId int64) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM shops WHERE id = $1 AND claimed_by = $2 AND claimed_until > NOW())`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var holds bool
+	err := m.db.QueryRowContext(ctx, query, shopId, reviewerId).Scan(&holds)
+	return holds, err
+}
+
+func (m ModerationModel) Stats() (ModerationStats, error) {
+	query := `
+	SELECT count(*),
+		count(*) FILTER (WHERE claimed_until > NOW()),
+		MIN(submitted_at),
+		COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM NOW() - submitted_at)), 0)
+	FROM shops
+	WHERE approval_status = 'PENDING'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var stats ModerationStats
+	err := m.db.QueryRowContext(ctx, query).Scan(&stats.Pending, &stats.Claimed, &stats.OldestSubmittedAt, &stats.MedianWaitSeconds)
+	return stats, err
+}
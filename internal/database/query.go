@@ -0,0 +1,33 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// queryBuilder collects WHERE conditions for listing queries together with
+// their arguments. Values are always bound as parameters; arg hands back the
+// placeholder to splice into the condition, numbered in the order added.
+type queryBuilder struct {
+	args       []interface{}
+	conditions []string
+}
+
+// arg binds value and returns its placeholder, e.g. "$3".
+func (q *queryBuilder) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+// where adds a condition; all conditions are ANDed together.
+func (q *queryBuilder) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// whereClause renders the conditions, or an empty string if there are none.
+func (q *queryBuilder) whereClause() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(q.conditions, "\n\t AND ")
+}
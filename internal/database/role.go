@@ -0,0 +1,324 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Mahider-T/autoSphere/validator"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateRole     = errors.New("duplicate role")
+	ErrUnknownRole       = errors.New("unknown role")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrRoleInUse         = errors.New("role in use")
+)
+
+// Permission codes checked by the server. They are seeded by migration and
+// assigned to roles through role_permissions; handlers never compare role
+// names directly.
+const (
+	PermissionUsersRead       = "users:read"
+	PermissionUsersWrite      = "users:write"
+	PermissionUsersDelete     = "users:delete"
+	PermissionSessionsManage  = "sessions:manage"
+	PermissionAPIKeysManage   = "api_keys:manage"
+	PermissionRolesManage     = "roles:manage"
+	PermissionShopsCreate     = "shops:create"
+	PermissionShopsWrite      = "shops:write"
+	PermissionShopsApprove    = "shops:approve"
+	PermissionCategoriesWrite = "categories:write"
+	PermissionFilesWrite      = "files:write"
+)
+
+type Permission struct {
+	Id          int64  `json:"id"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// RoleDefinition is a row of the roles table together with the codes of the
+// permissions granted to it. Users of a role with MFARequired set must log in
+// with a second factor before using role-protected routes.
+type RoleDefinition struct {
+	Id          int64    `json:"id"`
+	Name        Role     `json:"name"`
+	Description string   `json:"description"`
+	MFARequired bool     `json:"mfa_required"`
+	Permissions []string `json:"permissions"`
+}
+
+func ValidateRole(v *validator.Validator, role *RoleDefinition) {
+	var nameRegex = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+	v.Check(role.Name != "", "name", "name must not be empty")
+	v.Check(len(role.Name) <= 50, "name", "name must not be more than 50 bytes long")
+	v.Check(validator.Matches(string(role.Name), nameRegex), "name", "name must be upper case letters, digits and underscores")
+	v.Check(len(role.Description) <= 500, "description", "description must not be more than 500 bytes long")
+	v.Check(validator.Unique(role.Permissions), "permissions", "permissions must not contain duplicates")
+}
+
+type RoleModel struct {
+	db *sql.DB
+}
+
+const roleSelect = `
+	SELECT roles.id, roles.name, roles.description, roles.mfa_required,
+		COALESCE(array_agg(permissions.code ORDER BY permissions.code) FILTER (WHERE permissions.code IS NOT NULL), '{}')
+	FROM roles
+	LEFT JOIN role_permissions ON role_permissions.role_id = roles.id
+	LEFT JOIN permissions ON permissions.id = role_permissions.permission_id`
+
+func (m RoleModel) GetAll() ([]RoleDefinition, error) {
+	query := roleSelect + `
+	GROUP BY roles.id
+	ORDER BY roles.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []RoleDefinition{}
+	for rows.Next() {
+		var role RoleDefinition
+		err := rows.Scan(&role.Id, &role.Name, &role.Description, &role.MFARequired, pq.Array(&role.Permissions))
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (m RoleModel) Get(id int64) (*RoleDefinition, error) {
+	query := roleSelect + `
+	WHERE roles.id = $1
+	GROUP BY roles.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role RoleDefinition
+	err := m.db.QueryRowContext(ctx, query, id).Scan(&role.Id, &role.Name, &role.Description, &role.MFARequired, pq.Array(&role.Permissions))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &role, nil
+}
+
+// Create inserts the role and grants its permissions in one transaction.
+func (m RoleModel) Create(role *RoleDefinition) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO roles (name, description, mfa_required) VALUES ($1, $2, $3) RETURNING id`
+	err = tx.QueryRowContext(ctx, query, role.Name, role.Description, role.MFARequired).Scan(&role.Id)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "roles_name_key"):
+			return ErrDuplicateRole
+		default:
+			return err
+		}
+	}
+
+	if err = setRolePermissions(ctx, tx, role.Id, role.Permissions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Update saves the name, description and MFA setting and replaces the role's permission
+// set. Renaming cascades to users.role.
+func (m RoleModel) Update(role *RoleDefinition) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE roles SET name = $1, description = $2, mfa_required = $3 WHERE id = $4`
+	result, err := tx.ExecContext(ctx, query, role.Name, role.Description, role.MFARequired, role.Id)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "roles_name_key"):
+			return ErrDuplicateRole
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, role.Id); err != nil {
+		return err
+	}
+	if err = setRolePermissions(ctx, tx, role.Id, role.Permissions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setRolePermissions(ctx context.Context, tx *sql.Tx, roleId int64, codes []string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+
+	query := `
+	INSERT INTO role_permissions (role_id, permission_id)
+	SELECT $1, id FROM permissions WHERE code = ANY($2)`
+
+	result, err := tx.ExecContext(ctx, query, roleId, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != int64(len(codes)) {
+		return ErrUnknownPermission
+	}
+	return nil
+}
+
+// Delete removes a role. Roles still assigned to a user can't be deleted.
+func (m RoleModel) Delete(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, `DELETE FROM roles WHERE id = $1`, id)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "users_role_fkey"):
+			return ErrRoleInUse
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m RoleModel) GetAllPermissions() ([]Permission, error) {
+	query := `SELECT id, code, description FROM permissions ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []Permission{}
+	for rows.Next() {
+		var p Permission
+		if err := rows.Scan(&p.Id, &p.Code, &p.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// RoleGrants is a role's current name, whether it must use MFA and the
+// permission codes it grants.
+type RoleGrants struct {
+	Name        Role
+	MFARequired bool
+	Permissions map[string]bool
+}
+
+// PermissionsByRole returns every role's name, MFA setting and permission
+// codes keyed by role id, so a renamed role keeps its permissions. The server caches the
+// result instead of querying per request.
+func (m RoleModel) PermissionsByRole() (map[int64]RoleGrants, error) {
+	query := `
+	SELECT roles.id, roles.name, roles.mfa_required, permissions.code
+	FROM roles
+	LEFT JOIN role_permissions ON role_permissions.role_id = roles.id
+	LEFT JOIN permissions ON permissions.id = role_permissions.permission_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byRole := map[int64]RoleGrants{}
+	for rows.Next() {
+		var (
+			id          int64
+			name        Role
+			mfaRequired bool
+			code        sql.NullString
+		)
+		if err := rows.Scan(&id, &name, &mfaRequired, &code); err != nil {
+			return nil, err
+		}
+		grants, ok := byRole[id]
+		if !ok {
+			grants = RoleGrants{Name: name, MFARequired: mfaRequired, Permissions: map[string]bool{}}
+			byRole[id] = grants
+		}
+		if code.Valid {
+			grants.Permissions[code.String] = true
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return byRole, nil
+}
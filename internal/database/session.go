@@ -0,0 +1,226 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrSessionReused = errors.New("refresh token reused")
+)
+
+// Session is one refresh token in a login's rotation chain. Every rotation
+// inserts a new row with the same FamilyId, so the family represents the
+// device session while individual rows are single-use.
+type Session struct {
+	FamilyId   string    `json:"id"`
+	Plaintext  string    `json:"-"`
+	Hash       []byte    `json:"-"`
+	UserId     int64     `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	Created_At time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Expiry     time.Time `json:"expiry"`
+	MFA        bool      `json:"mfa"`
+}
+
+type SessionModel struct {
+	db *sql.DB
+}
+
+// New starts a new session family for the user and returns it with the
+// plaintext refresh token set.
+func (m SessionModel) New(userId int64, ttl time.Duration, userAgent, ipAddress string, mfa bool) (*Session, error) {
+	token, err := generateToken(userId, ttl, ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		Plaintext: token.Plaintext,
+		Hash:      token.Hash,
+		UserId:    userId,
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+		Expiry:    token.Expiry,
+		MFA:       mfa,
+	}
+
+	query := `
+	INSERT INTO sessions (hash, user_id, user_agent, ip_address, expiry, mfa)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING family_id, created_at, last_used_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{session.Hash, session.UserId, session.UserAgent, session.IPAddress, session.Expiry, session.MFA}
+	err = m.db.QueryRowContext(ctx, query, args...).Scan(&session.FamilyId, &session.Created_At, &session.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Rotate exchanges a refresh token for a new one in the same family. Presenting
+// a token that was already rotated or revoked revokes the whole family and
+// returns ErrSessionReused.
+func (m SessionModel) Rotate(plaintext string, ttl time.Duration, userAgent, ipAddress string) (*Session, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		id        int64
+		current   Session
+		rotatedAt sql.NullTime
+		revokedAt sql.NullTime
+	)
+	query := `
+	SELECT id, family_id, user_id, created_at, expiry, mfa, rotated_at, revoked_at
+	FROM sessions
+	WHERE hash = $1
+	FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, hash[:]).Scan(
+		&id, &current.FamilyId, &current.UserId, &current.Created_At, &current.Expiry, &current.MFA, &rotatedAt, &revokedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if rotatedAt.Valid || revokedAt.Valid {
+		query = `UPDATE sessions SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+		if _, err = tx.ExecContext(ctx, query, current.FamilyId); err != nil {
+			return nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrSessionReused
+	}
+
+	if current.Expiry.Before(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	token, err := generateToken(current.UserId, ttl, ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE sessions SET rotated_at = NOW() WHERE id = $1`, id); err != nil {
+		return nil, err
+	}
+
+	next := &Session{
+		FamilyId:   current.FamilyId,
+		Plaintext:  token.Plaintext,
+		Hash:       token.Hash,
+		UserId:     current.UserId,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		Created_At: current.Created_At,
+		Expiry:     token.Expiry,
+		MFA:        current.MFA,
+	}
+	query = `
+	INSERT INTO sessions (family_id, hash, user_id, user_agent, ip_address, created_at, expiry, mfa)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING last_used_at`
+	args := []interface{}{next.FamilyId, next.Hash, next.UserId, next.UserAgent, next.IPAddress, next.Created_At, next.Expiry, next.MFA}
+	if err = tx.QueryRowContext(ctx, query, args...).Scan(&next.LastUsedAt); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// RevokeFamily ends the session the given refresh token belongs to.
+func (m SessionModel) RevokeFamily(plaintext string) error {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	query := `
+	UPDATE sessions SET revoked_at = NOW()
+	WHERE family_id = (SELECT family_id FROM sessions WHERE hash = $1)
+	AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, query, hash[:])
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m SessionModel) RevokeAllForUser(userId int64) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.db.ExecContext(ctx, query, userId)
+	return err
+}
+
+// GetAllForUser lists the user's active sessions, one row per family.
+func (m SessionModel) GetAllForUser(userId int64) ([]Session, error) {
+	query := `
+	SELECT family_id, user_id, user_agent, ip_address, created_at, last_used_at, expiry, mfa
+	FROM sessions
+	WHERE user_id = $1 AND rotated_at IS NULL AND revoked_at IS NULL AND expiry > NOW()
+	ORDER BY last_used_at DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		err := rows.Scan(&s.FamilyId, &s.UserId, &s.UserAgent, &s.IPAddress, &s.Created_At, &s.LastUsedAt, &s.Expiry, &s.MFA)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
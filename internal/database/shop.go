@@ -3,9 +3,12 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,27 +27,67 @@ const (
 type Shop struct {
 	Id              int                `json:"id"`
 	Name            string             `json:"name"`
-	Phone_Number    string             `json:"phone_number"`
-	Email           string             `json:"email"`
+	Phone_Number    string             `json:"phone_number,omitempty"`
+	Email           string             `json:"email,omitempty"`
 	Approval_Status ShopApprovalStatus `json:"approval_status"`
 	Location        string             `json:"location"`
-	Coordinate      string             `json:"coordinate"` // Should be in "longitude latitude" format
+	Latitude        float64            `json:"latitude"`
+	Longitude       float64            `json:"longitude"`
 	Thumbnail       *string            `json:"thumbnail"`
 	Photos          []string           `json:"photos"`
 	Files           []string           `json:"files"`
 	Created_At      time.Time          `json:"-"`
 	Created_By      int                `json:"created_by"`
+	Categories      ShopCategories     `json:"categories"`
+	// Distance from the search point, only set on geo searches.
+	Distance_M *float64 `json:"distance_m,omitempty"`
+	// Rank and Highlight are only set on text searches. Highlight is the name
+	// and location as escaped HTML, with matched terms wrapped in <mark>.
+	Rank      *float64 `json:"rank,omitempty"`
+	Highlight *string  `json:"highlight,omitempty"`
+}
+
+// GeoPoint is a WGS 84 position.
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// ewkt renders the point for ST_GeogFromText. PostGIS wants longitude first.
+func (p GeoPoint) ewkt() string {
+	return fmt.Sprintf("SRID=4326;POINT(%s %s)",
+		strconv.FormatFloat(p.Longitude, 'f', -1, 64), strconv.FormatFloat(p.Latitude, 'f', -1, 64))
+}
+
+func ValidateGeoPoint(v *validator.Validator, p GeoPoint) {
+	v.Check(p.Latitude >= -90 && p.Latitude <= 90, "latitude", "latitude must be between -90 and 90")
+	v.Check(p.Longitude >= -180 && p.Longitude <= 180, "longitude", "longitude must be between -180 and 180")
+}
+
+func (sh *Shop) point() GeoPoint {
+	return GeoPoint{Latitude: sh.Latitude, Longitude: sh.Longitude}
+}
+
+// RedactContact blanks the contact fields for the public projection of a
+// shop; they are only shown to the creator and staff.
+func (sh *Shop) RedactContact() {
+	sh.Phone_Number = ""
+	sh.Email = ""
+}
+
+// EditableByCreator reports whether the shop's creator may still change or
+// delete it. Once approved, only staff can touch it.
+func (sh *Shop) EditableByCreator() bool {
+	return sh.Approval_Status == PENDING || sh.Approval_Status == DECLINED
 }
 
 func ValidateShop(v *validator.Validator, sh *Shop) {
 	var phoneRegex = regexp.MustCompile(`^(09|07)\d{8}$`)
 	var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	var coordinateRegex = regexp.MustCompile(`^\d+ \d+$`)
 
 	v.Check(sh.Name != "", "name", "name must not be empty")
 	v.Check(sh.Location != "", "location", "location must not be empty")
-	v.Check(sh.Coordinate != "", "coordinate", "coordinate can not me empty")
-	v.Check(validator.Matches(sh.Coordinate, coordinateRegex), "coordinate", "coordinate must be logitude and latitute separated by space")
+	ValidateGeoPoint(v, sh.point())
 	v.Check(validator.Matches(sh.Phone_Number, phoneRegex), "phone_number", "phone number must start with 07 or 09 and must be 10 digits long")
 	v.Check(validator.Matches(sh.Email, emailRegex), "email", "not a valid email")
 }
@@ -53,13 +96,15 @@ type ShopModel struct {
 	db *sql.DB
 }
 
-func (sh ShopModel) Create(shop *Shop) error {
+// Create inserts the shop and links it to the category members in one
+// transaction. The shop's categories are labelled for locale.
+func (sh ShopModel) Create(shop *Shop, categoryMembers []CategoryMemberRef, locale string) error {
 	query := `
 		INSERT INTO shops 
 			(name, phone_number, email, location, coordinate, thumbnail,photos, approval_status, created_by, files)
 		VALUES 
 			($1, $2, $3, $4, ST_GeogFromText($5), $6, $7, $8, $9, $10)
-		RETURNING id, name, phone_number, email, location, ST_AsText(coordinate), thumbnail, photos, created_at, approval_status, created_by, files;`
+		RETURNING id, name, phone_number, email, location, ST_Y(coordinate::geometry), ST_X(coordinate::geometry), thumbnail, photos, created_at, approval_status, created_by, files;`
 
 	ctx, close := context.WithTimeout(context.Background(), 3*time.Second)
 	defer close()
@@ -68,30 +113,52 @@ func (sh ShopModel) Create(shop *Shop) error {
 		shop.Phone_Number,
 		shop.Email,
 		shop.Location,
-		fmt.Sprintf("SRID=4326;POINT(%s)", shop.Coordinate),
+		shop.point().ewkt(),
 		shop.Thumbnail,
 		pq.Array(shop.Photos),
 		shop.Approval_Status,
 		shop.Created_By,
-		pq.Array(shop.Files),
+		pq.Array(&shop.Files),
+	}
+
+	tx, err := sh.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&shop.Id, &shop.Name, &shop.Phone_Number, &shop.Email, &shop.Location, &shop.Latitude, &shop.Longitude, &shop.Thumbnail, pq.Array(&shop.Photos), &shop.Created_At, &shop.Approval_Status, &shop.Created_By, pq.Array(&shop.Files))
+	if err != nil {
+		return err
+	}
+
+	if err = replaceShopCategories(ctx, tx, shop.Id, categoryMembers); err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT `+shopCategoriesColumn("$2")+` FROM shops WHERE id = $1`, shop.Id, locale).Scan(&shop.Categories)
+	if err != nil {
+		return err
 	}
-	return sh.db.QueryRowContext(ctx, query, args...).Scan(&shop.Id, &shop.Name, &shop.Phone_Number, &shop.Email, &shop.Location, &shop.Coordinate, &shop.Thumbnail, pq.Array(&shop.Photos), &shop.Created_At, &shop.Approval_Status, &shop.Created_By, pq.Array(shop.Files))
+
+	return tx.Commit()
 }
 
-func (sh ShopModel) Get(id int64) (*Shop, error) {
+// Get returns the shop with its categories labelled for locale.
+func (sh ShopModel) Get(id int64, locale string) (*Shop, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `SELECT id, name, phone_number, email, location, ST_AsText(coordinate), thumbnail, photos, created_at, approval_status, created_by, files FROM shops WHERE id=$1`
+	query := `SELECT id, name, phone_number, email, location, ST_Y(coordinate::geometry), ST_X(coordinate::geometry), thumbnail, photos, created_at, approval_status, created_by, files, ` + shopCategoriesColumn("$2") + ` FROM shops WHERE id=$1`
 
 	var shop Shop
 	ctx, close := context.WithTimeout(context.Background(), 3*time.Second)
 	defer close()
 
-	err := sh.db.QueryRowContext(ctx, query, id).Scan(
+	err := sh.db.QueryRowContext(ctx, query, id, locale).Scan(
 		&shop.Id, &shop.Name, &shop.Phone_Number, &shop.Email,
-		&shop.Location, &shop.Coordinate, &shop.Thumbnail, pq.Array(&shop.Photos), &shop.Created_At, &shop.Approval_Status, &shop.Created_By, pq.Array(shop.Files),
+		&shop.Location, &shop.Latitude, &shop.Longitude, &shop.Thumbnail, pq.Array(&shop.Photos), &shop.Created_At, &shop.Approval_Status, &shop.Created_By, pq.Array(&shop.Files), &shop.Categories,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -102,12 +169,16 @@ func (sh ShopModel) Get(id int64) (*Shop, error) {
 
 	return &shop, nil
 }
-func (sh ShopModel) Patch(shop *Shop) error {
+
+// Patch saves the shop's fields. When categoryMembers is not nil the shop's
+// category members are replaced with them in the same transaction. The shop's
+// categories are labelled for locale.
+func (sh ShopModel) Patch(shop *Shop, categoryMembers *[]CategoryMemberRef, locale string) error {
 	query := `
 		UPDATE shops 
 		SET name=$1, phone_number=$2, email=$3, location=$4, coordinate=ST_GeogFromText($5), thumbnail=$6, photos=$7
 		WHERE id=$8
-		RETURNING id, name, phone_number, email, location, ST_AsText(coordinate), thumbnail, photos, created_at, approval_status, created_by;
+		RETURNING id, name, phone_number, email, location, ST_Y(coordinate::geometry), ST_X(coordinate::geometry), thumbnail, photos, created_at, approval_status, created_by;
 	`
 
 	ctx, close := context.WithTimeout(context.Background(), 3*time.Second)
@@ -118,17 +189,43 @@ func (sh ShopModel) Patch(shop *Shop) error {
 		shop.Phone_Number,
 		shop.Email,
 		shop.Location,
-		fmt.Sprintf("SRID=4326;POINT(%s)", shop.Coordinate),
+		shop.point().ewkt(),
 		shop.Thumbnail,
 		pq.Array(shop.Photos),
 		shop.Id,
 	}
 
-	return sh.db.QueryRowContext(ctx, query, args...).Scan(
+	tx, err := sh.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
 		&shop.Id, &shop.Name, &shop.Phone_Number, &shop.Email,
-		&shop.Location, &shop.Coordinate, &shop.Thumbnail, pq.Array(&shop.Photos), &shop.Created_At, &shop.Approval_Status, &shop.Created_By,
+		&shop.Location, &shop.Latitude, &shop.Longitude, &shop.Thumbnail, pq.Array(&shop.Photos), &shop.Created_At, &shop.Approval_Status, &shop.Created_By,
 	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	if categoryMembers != nil {
+		if err = replaceShopCategories(ctx, tx, shop.Id, *categoryMembers); err != nil {
+			return err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT `+shopCategoriesColumn("$2")+` FROM shops WHERE id = $1`, shop.Id, locale).Scan(&shop.Categories)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
+
 func (sh ShopModel) Delete(id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
@@ -155,54 +252,222 @@ func (sh ShopModel) Delete(id int64) error {
 	return nil
 }
 
-func (sh ShopModel) GetAll(name, coordinate string, maxDistance int, filters Filters, categoryValues []string) ([]Shop, Metadata, error) {
-	fmt.Print("Category members are :- ", categoryValues)
-	var query string
-	var args []interface{}
-
-	// baseQuery with fully qualified references for ids
-	baseQuery := `SELECT count(*) OVER (), shops.id AS shop_id, shops.name, shops.phone_number, shops.email, shops.location, 
-				  ST_AsText(shops.coordinate), shops.thumbnail, shops.photos, shops.created_at, shops.approval_status, shops.created_by
-				  FROM shops
-				  LEFT JOIN shop_categories ON shops.id = shop_categories.shop_id
-				  LEFT JOIN category_members ON shop_categories.category_member_id = category_members.id
-				  WHERE (to_tsvector('simple', shops.name) @@ plainto_tsquery('simple', $1) OR $1 = '')`
-	args = append(args, name)
-
-	if len(categoryValues) > 0 {
-
-		baseQuery += ` AND category_members.value IN (` + generatePlaceholders(len(categoryValues)) + `)`
-		for _, value := range categoryValues {
-			args = append(args, value)
+// ShopVisibility limits which shops a listing may return. Staff see every
+// shop; everyone else sees approved shops plus, when ViewerId is set, their
+// own submissions.
+type ShopVisibility struct {
+	All      bool
+	ViewerId int64
+}
+
+// Allows reports whether the shop is visible under v.
+func (v ShopVisibility) Allows(sh *Shop) bool {
+	return v.All || sh.Approval_Status == APPROVED || v.owns(sh)
+}
+
+// ShowsContact reports whether the shop's contact fields are visible under v.
+func (v ShopVisibility) ShowsContact(sh *Shop) bool {
+	return v.All || v.owns(sh)
+}
+
+func (v ShopVisibility) owns(sh *Shop) bool {
+	return v.ViewerId != 0 && int64(sh.Created_By) == v.ViewerId
+}
+
+type ShopFilter struct {
+	Name string
+	// Query is a web search style text query over name, category values and
+	// location. Misspelt names still match by trigram similarity.
+	Query string
+	// Near limits results to shops within RadiusM metres of the point and
+	// adds their distance to each result.
+	Near    *GeoPoint
+	RadiusM float64
+	// BBox and Within limit results to a map viewport or a search area.
+	BBox   *BoundingBox
+	Within *Geometry
+	// OpenAt limits results to shops open at that instant, judged by each
+	// shop's weekly hours and closures in its own timezone.
+	OpenAt *time.Time
+	// CategoryMembers are category slugs or category member slugs, the
+	// latter optionally qualified by their category.
+	CategoryMembers  []CategoryMemberRef
+	CategoryClauses  []CategoryClause
+	ApprovalStatuses []ShopApprovalStatus
+	Visibility       ShopVisibility
+	// Locale picks the language of category and facet labels.
+	Locale  string
+	Filters Filters
+}
+
+// where adds the filter's conditions, apart from the Near search, to q.
+func (filter ShopFilter) where(q *queryBuilder) {
+	switch {
+	case filter.Visibility.All:
+	case filter.Visibility.ViewerId != 0:
+		q.where(fmt.Sprintf("(shops.approval_status = 'APPROVED' OR shops.created_by = %s)", q.arg(filter.Visibility.ViewerId)))
+	default:
+		q.where("shops.approval_status = 'APPROVED'")
+	}
+
+	if len(filter.ApprovalStatuses) > 0 {
+		statuses := make([]string, len(filter.ApprovalStatuses))
+		for i, status := range filter.ApprovalStatuses {
+			statuses[i] = string(status)
+		}
+		q.where(fmt.Sprintf("shops.approval_status::text = ANY(%s)", q.arg(pq.Array(statuses))))
+	}
+
+	if filter.Name != "" {
+		// The search_vector match is answered by its GIN index; the name
+		// match then drops shops that only matched on categories or location.
+		name := fmt.Sprintf("plainto_tsquery('simple', %s)", q.arg(filter.Name))
+		q.where(fmt.Sprintf("shops.search_vector @@ %[1]s AND to_tsvector('simple', shops.name) @@ %[1]s", name))
+	}
+
+	if filter.Query != "" {
+		query := q.arg(filter.Query)
+		q.where(fmt.Sprintf("(shops.search_vector @@ websearch_to_tsquery('simple', %[1]s) OR shops.name %% %[1]s)", query))
+	}
+
+	// The shop must match every requested ref. An unqualified slug names
+	// either a category member or a category, which matches members anywhere
+	// in its subtree. A qualified one names a member of the category or its
+	// subcategories.
+	for _, ref := range filter.CategoryMembers {
+		match := fmt.Sprintf("(category_members.slug = %[1]s OR categories.path <@ (SELECT path FROM categories WHERE slug = %[1]s))", q.arg(ref.Slug))
+		if ref.Category != "" {
+			match = fmt.Sprintf("category_members.slug = %s AND categories.path <@ ARRAY(SELECT path FROM categories WHERE slug = %s)", q.arg(ref.Slug), q.arg(ref.Category))
 		}
+		q.where(fmt.Sprintf(`EXISTS (
+			SELECT 1
+			FROM shop_categories
+			INNER JOIN category_members ON shop_categories.category_member_id = category_members.id
+			INNER JOIN categories ON category_members.category_id = categories.id
+			WHERE shop_categories.shop_id = shops.id
+			AND %s)`, match))
+	}
 
-		// Group by shop ID and ensure the shop has all the required category values
-		baseQuery += ` GROUP BY shops.id HAVING COUNT(DISTINCT category_members.value) = ` + fmt.Sprintf("%d", len(categoryValues))
+	for _, clause := range filter.CategoryClauses {
+		// Members of the named category or any of its subcategories.
+		members := fmt.Sprintf(`
+			SELECT 1
+			FROM shop_categories
+			INNER JOIN category_members ON shop_categories.category_member_id = category_members.id
+			INNER JOIN categories ON category_members.category_id = categories.id
+			WHERE shop_categories.shop_id = shops.id
+			AND categories.path <@ ARRAY(SELECT path FROM categories WHERE slug = %s)`,
+			q.arg(clause.Category))
+
+		if len(clause.AnyOf) > 0 {
+			q.where(fmt.Sprintf("EXISTS (%s AND category_members.slug = ANY(%s))", members, q.arg(pq.Array(clause.AnyOf))))
+		}
+		for _, value := range clause.AllOf {
+			q.where(fmt.Sprintf("EXISTS (%s AND category_members.slug = %s)", members, q.arg(value)))
+		}
+		if len(clause.NoneOf) > 0 {
+			q.where(fmt.Sprintf("NOT EXISTS (%s AND category_members.slug = ANY(%s))", members, q.arg(pq.Array(clause.NoneOf))))
+		}
 	}
 
-	if coordinate != "" {
-		// Add the maxDistance filter to the query
-		query = fmt.Sprintf(`%s AND ST_Distance(shops.coordinate, ST_GeogFromText($%d)) <= $%d
-							ORDER BY ST_Distance(shops.coordinate, ST_GeogFromText($%d)) ASC, shops.id ASC
-							LIMIT $%d OFFSET $%d`,
-			baseQuery, len(args)+1, len(args)+2, len(args)+1, len(args)+3, len(args)+4)
+	if filter.BBox != nil {
+		// && on geography compares bounding boxes and is answered by the GIST
+		// index.
+		envelopes := []string{}
+		for _, b := range filter.BBox.Envelopes() {
+			envelopes = append(envelopes, fmt.Sprintf("shops.coordinate && ST_MakeEnvelope(%s, %s, %s, %s, 4326)::geography",
+				q.arg(b.MinLng), q.arg(b.MinLat), q.arg(b.MaxLng), q.arg(b.MaxLat)))
+		}
+		q.where("(" + strings.Join(envelopes, " OR ") + ")")
+	}
+
+	if filter.Within != nil {
+		// Marshalling can't fail: Coordinates is JSON that already decoded in
+		// ValidateGeometry.
+		geometry, _ := json.Marshal(filter.Within)
+		q.where(fmt.Sprintf("ST_Intersects(shops.coordinate, ST_SetSRID(ST_GeomFromGeoJSON(%s), 4326)::geography)", q.arg(string(geometry))))
+	}
+
+	if filter.OpenAt != nil {
+		local := fmt.Sprintf("(%s::timestamptz AT TIME ZONE shops.timezone)", q.arg(*filter.OpenAt))
+		q.where(fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM shop_hours
+			WHERE shop_hours.shop_id = shops.id
+			AND shop_hours.weekday = EXTRACT(DOW FROM %[1]s)
+			AND %[1]s::time >= shop_hours.opens_at
+			AND %[1]s::time < shop_hours.closes_at)
+		AND NOT EXISTS (
+			SELECT 1 FROM shop_closures
+			WHERE shop_closures.shop_id = shops.id
+			AND %[1]s::date BETWEEN shop_closures.starts_on AND shop_closures.ends_on)`, local))
+	}
+}
+
+// near adds the Near search condition to q and returns the expression for
+// each shop's distance from the point, NULL when there is no point.
+// ST_DWithin on the geography column can use the GIST index; the distance
+// itself is only computed for the rows that pass it.
+func (filter ShopFilter) near(q *queryBuilder) string {
+	if filter.Near == nil {
+		return "NULL::float8"
+	}
+	point := fmt.Sprintf("ST_GeogFromText(%s)", q.arg(filter.Near.ewkt()))
+	q.where(fmt.Sprintf("ST_DWithin(shops.coordinate, %s, %s)", point, q.arg(filter.RadiusM)))
+	return fmt.Sprintf("ST_Distance(shops.coordinate, %s)", point)
+}
+
+// ts_headline marks matches with these control characters rather than HTML,
+// so the shop's own text can be escaped before the markers become <mark>
+// tags. They are stripped from the text first so a shop can't forge one.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+var highlightMarks = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
 
-		// Add the maxDistance argument and the rest of the pagination arguments
-		args = append(args, fmt.Sprintf("SRID=4326;POINT(%s)", coordinate), maxDistance, filters.limit(), filters.offset())
-	} else {
-		query = fmt.Sprintf(`%s ORDER BY shops.id ASC
-							LIMIT $%d OFFSET $%d`,
-			baseQuery, len(args)+1, len(args)+2)
+func markHighlight(s string) string {
+	return highlightMarks.Replace(html.EscapeString(s))
+}
+
+func (sh ShopModel) GetAll(filter ShopFilter) ([]Shop, Metadata, error) {
+	q := &queryBuilder{}
+	filter.where(q)
+	distance := filter.near(q)
+
+	rank, highlight := "NULL::float8", "NULL::text"
+	if filter.Query != "" {
+		query := q.arg(filter.Query)
+		tsquery := fmt.Sprintf("websearch_to_tsquery('simple', %s)", query)
+		rank = fmt.Sprintf("ts_rank(shops.search_vector, %s) + similarity(shops.name, %s)", tsquery, query)
+		highlight = fmt.Sprintf("ts_headline('simple', translate(shops.name || ' - ' || shops.location, %s, ''), %s, %s)",
+			q.arg(highlightStart+highlightStop), tsquery, q.arg("StartSel="+highlightStart+", StopSel="+highlightStop+", HighlightAll=true"))
+	}
 
-		args = append(args, filters.limit(), filters.offset())
+	sortColumn := "shops." + filter.Filters.sortColumn()
+	sortDirection := filter.Filters.sortDirection()
+	switch sortColumn {
+	case "shops.distance":
+		sortColumn = "distance_m"
+	case "shops.relevance":
+		// Best match first.
+		sortColumn, sortDirection = "rank", "DESC"
 	}
+	orderBy := fmt.Sprintf("%s %s, shops.id ASC", sortColumn, sortDirection)
+
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER (), shops.id, shops.name, shops.phone_number, shops.email, shops.location,
+		ST_Y(shops.coordinate::geometry), ST_X(shops.coordinate::geometry), shops.thumbnail, shops.photos, shops.created_at, shops.approval_status, shops.created_by,
+		%s AS distance_m, %s AS rank, %s AS highlight, %s
+	FROM shops
+	%s
+	ORDER BY %s
+	LIMIT %s OFFSET %s`, distance, rank, highlight, shopCategoriesColumn(q.arg(filter.Locale)), q.whereClause(), orderBy, q.arg(filter.Filters.limit()), q.arg(filter.Filters.offset()))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	fmt.Printf("Base query is here bro \n %s\n\n", baseQuery)
-
-	rows, err := sh.db.QueryContext(ctx, query, args...)
+	rows, err := sh.db.QueryContext(ctx, query, q.args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -214,21 +479,30 @@ func (sh ShopModel) GetAll(name, coordinate string, maxDistance int, filters Fil
 		var shop Shop
 		err := rows.Scan(
 			&totalRecords,
-			&shop.Id, // This corresponds to shops.id as shop_id
+			&shop.Id,
 			&shop.Name,
 			&shop.Phone_Number,
 			&shop.Email,
 			&shop.Location,
-			&shop.Coordinate,
+			&shop.Latitude,
+			&shop.Longitude,
 			&shop.Thumbnail,
 			pq.Array(&shop.Photos),
 			&shop.Created_At,
 			&shop.Approval_Status,
 			&shop.Created_By,
+			&shop.Distance_M,
+			&shop.Rank,
+			&shop.Highlight,
+			&shop.Categories,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
+		if shop.Highlight != nil {
+			highlighted := markHighlight(*shop.Highlight)
+			shop.Highlight = &highlighted
+		}
 		shops = append(shops, shop)
 	}
 
@@ -236,31 +510,191 @@ func (sh ShopModel) GetAll(name, coordinate string, maxDistance int, filters Fil
 		return nil, Metadata{}, err
 	}
 
-	metadata := filters.calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	metadata := filter.Filters.calculateMetadata(totalRecords, filter.Filters.Page, filter.Filters.PageSize)
 
 	return shops, metadata, nil
 }
 
-func (sh ShopModel) UpdateAppoval(id int64, approvalStatus ShopApprovalStatus) error {
+// FacetCount is the number of matching shops carrying a category member.
+type FacetCount struct {
+	Id    int    `json:"id"`
+	Slug  string `json:"slug"`
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// ShopFacets are facet counts grouped by category slug, most common member
+// first.
+type ShopFacets map[string][]FacetCount
+
+// Facets counts, for every category member, the shops matching filter that
+// carry it. The counts cover the whole result set, not just one page.
+func (sh ShopModel) Facets(filter ShopFilter) (ShopFacets, error) {
+	q := &queryBuilder{}
+	filter.where(q)
+	filter.near(q)
+
+	query := fmt.Sprintf(`
+	SELECT categories.slug, category_members.id, category_members.slug, %s AS label, count(*)
+	FROM shops
+	INNER JOIN shop_categories ON shop_categories.shop_id = shops.id
+	INNER JOIN category_members ON shop_categories.category_member_id = category_members.id
+	INNER JOIN categories ON category_members.category_id = categories.id
+	%s
+	GROUP BY categories.slug, category_members.id
+	ORDER BY categories.slug, count(*) DESC, label`, categoryMemberLabel(q.arg(filter.Locale)), q.whereClause())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := sh.Get(id)
+	rows, err := sh.db.QueryContext(ctx, query, q.args...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := ShopFacets{}
+	for rows.Next() {
+		var category string
+		var facet FacetCount
+		if err := rows.Scan(&category, &facet.Id, &facet.Slug, &facet.Label, &facet.Count); err != nil {
+			return nil, err
+		}
+		facets[category] = append(facets[category], facet)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
+
+// ShopCluster is a group of nearby shops for a zoomed-out map. ShopId is only
+// set when the cluster is a single shop, so the marker can link straight to it.
+type ShopCluster struct {
+	Count     int     `json:"count"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	ShopId    *int64  `json:"shop_id,omitempty"`
+}
+
+// Clusters groups the shops matching filter into square grid cells cellSize
+// degrees wide, returning one cluster per non-empty cell positioned at the
+// centroid of its shops. At most limit clusters are returned, largest first.
+func (sh ShopModel) Clusters(filter ShopFilter, cellSize float64, limit int) ([]ShopCluster, error) {
+	q := &queryBuilder{}
+	filter.where(q)
+
+	query := fmt.Sprintf(`
+	SELECT count(*),
+		ST_Y(ST_Centroid(ST_Collect(shops.coordinate::geometry))),
+		ST_X(ST_Centroid(ST_Collect(shops.coordinate::geometry))),
+		CASE WHEN count(*) = 1 THEN MIN(shops.id) END
+	FROM shops
+	%s
+	GROUP BY ST_SnapToGrid(shops.coordinate::geometry, %s)
+	ORDER BY count(*) DESC
+	LIMIT %s`, q.whereClause(), q.arg(cellSize), q.arg(limit))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := sh.db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
+
+	clusters := []ShopCluster{}
+	for rows.Next() {
+		var c ShopCluster
+		if err := rows.Scan(&c.Count, &c.Latitude, &c.Longitude, &c.ShopId); err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return clusters, nil
+}
 
-	query := `UPDATE shops 
-			  SET approval_status=$1 RETURNING id, approval_status`
+// Tile renders the approved shops in web mercator tile z/x/y as a Mapbox
+// Vector Tile with a single "shops" layer.
+func (sh ShopModel) Tile(z, x, y int) ([]byte, error) {
+	query := `
+	WITH bounds AS (
+		SELECT ST_TileEnvelope($1, $2, $3) AS geom
+	),
+	features AS (
+		SELECT ST_AsMVTGeom(ST_Transform(shops.coordinate::geometry, 3857), bounds.geom) AS geom,
+			shops.id, shops.name, shops.location, shops.thumbnail
+		FROM shops, bounds
+		WHERE shops.approval_status = 'APPROVED'
+		AND shops.coordinate && ST_Transform(bounds.geom, 4326)::geography
+	)
+	SELECT ST_AsMVT(features.*, 'shops', 4096, 'geom') FROM features`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
-	return sh.db.QueryRowContext(ctx, query, approvalStatus).Scan(&id, &approvalStatus)
+	var tile []byte
+	err := sh.db.QueryRowContext(ctx, query, z, x, y).Scan(&tile)
+	return tile, err
 }
 
-func generatePlaceholders(n int) string {
-	placeholders := make([]string, n)
-	for i := range placeholders {
-		placeholders[i] = fmt.Sprintf("$%d", i+2) // Start from $2 to avoid conflicting with existing $1
+// GetAllForUser lists the shops a user submitted, optionally narrowed to one
+// approval status, with categories labelled for locale.
+func (sh ShopModel) GetAllForUser(userId int64, approvalStatus string, locale string, filters Filters) ([]Shop, Metadata, error) {
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, name, phone_number, email, location, ST_Y(coordinate::geometry), ST_X(coordinate::geometry), thumbnail, photos, created_at, approval_status, created_by, %s
+			  FROM shops
+			  WHERE created_by = $1
+			  AND ($2 = '' OR approval_status = $2::approval_status)
+			  ORDER BY %s %s, id ASC
+			  LIMIT $3 OFFSET $4`, shopCategoriesColumn("$5"), filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := sh.db.QueryContext(ctx, query, userId, approvalStatus, filters.limit(), filters.offset(), locale)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	shops := []Shop{}
+	for rows.Next() {
+		var shop Shop
+		err := rows.Scan(
+			&totalRecords,
+			&shop.Id,
+			&shop.Name,
+			&shop.Phone_Number,
+			&shop.Email,
+			&shop.Location,
+			&shop.Latitude,
+			&shop.Longitude,
+			&shop.Thumbnail,
+			pq.Array(&shop.Photos),
+			&shop.Created_At,
+			&shop.Approval_Status,
+			&shop.Created_By,
+			&shop.Categories,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		shops = append(shops, shop)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
 	}
-	return strings.Join(placeholders, ", ")
+
+	metadata := filters.calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return shops, metadata, nil
 }
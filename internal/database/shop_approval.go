@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+var (
+	ErrInvalidTransition = errors.New("invalid approval status transition")
+	ErrShopClaimed       = errors.New("shop claimed by another reviewer")
+)
+
+// ShopApprovalEvent is one entry of a shop's moderation trail. ActorId is nil
+// once the acting user has been deleted.
+type ShopApprovalEvent struct {
+	Id         int64              `json:"id"`
+	ShopId     int64              `json:"shop_id"`
+	ActorId    *int64             `json:"actor_id"`
+	From       ShopApprovalStatus `json:"from_status"`
+	To         ShopApprovalStatus `json:"to_status"`
+	Reason     string             `json:"reason"`
+	Created_At time.Time          `json:"created_at"`
+}
+
+// approvalTransitions lists the allowed moves between approval states.
+// Reviewers decide on pending shops; creators resubmit declined ones.
+var approvalTransitions = map[ShopApprovalStatus][]ShopApprovalStatus{
+	PENDING:  {APPROVED, DECLINED},
+	DECLINED: {PENDING},
+}
+
+func CanTransition(from, to ShopApprovalStatus) bool {
+	for _, allowed := range approvalTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidateApprovalEvent(v *validator.Validator, e *ShopApprovalEvent) {
+	v.Check(validator.In(string(e.To), string(PENDING), string(APPROVED), string(DECLINED)), "approval_status", "must be one of PENDING, APPROVED or DECLINED")
+	if e.To == DECLINED {
+		v.Check(e.Reason != "", "reason", "a reason must be given when declining a shop")
+	}
+	v.Check(len(e.Reason) <= 1000, "reason", "reason must not be more than 1000 bytes long")
+}
+
+// Transition moves the shop to e.To and records the event. The shop row is
+// locked for the duration so concurrent reviewers can't both act on the same
+// state; ErrInvalidTransition is returned if the move isn't allowed from the
+// shop's current status, and ErrShopClaimed if another reviewer holds a live
+// moderation claim on it. Any claim is released, and moving back to PENDING
+// puts the shop at the end of the queue. e.From and e.Created_At are filled in.
+func (sh ShopModel) Transition(e *ShopApprovalEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := sh.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		claimedBy    sql.NullInt64
+		claimedUntil sql.NullTime
+	)
+	query := `SELECT approval_status, claimed_by, claimed_until FROM shops WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, e.ShopId).Scan(&e.From, &claimedBy, &claimedUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if !CanTransition(e.From, e.To) {
+		return ErrInvalidTransition
+	}
+
+	claimLive := claimedBy.Valid && claimedUntil.Valid && claimedUntil.Time.After(time.Now())
+	if claimLive && (e.ActorId == nil || *e.ActorId != claimedBy.Int64) {
+		return ErrShopClaimed
+	}
+
+	query = `
+	UPDATE shops
+	SET approval_status = $1, claimed_by = NULL, claimed_until = NULL,
+		submitted_at = CASE WHEN $2 THEN NOW() ELSE submitted_at END
+	WHERE id = $3`
+	if _, err = tx.ExecContext(ctx, query, e.To, e.To == PENDING, e.ShopId); err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO shop_approval_events (shop_id, actor_id, from_status, to_status, reason)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+	args := []interface{}{e.ShopId, e.ActorId, e.From, e.To, e.Reason}
+	if err = tx.QueryRowContext(ctx, query, args...).Scan(&e.Id, &e.Created_At); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ApprovalHistory returns the shop's moderation trail, oldest first.
+func (sh ShopModel) ApprovalHistory(shopId int64) ([]ShopApprovalEvent, error) {
+	query := `
+	SELECT id, shop_id, actor_id, from_status, to_status, reason, created_at
+	FROM shop_approval_events
+	WHERE shop_id = $1
+	ORDER BY created_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := sh.db.QueryContext(ctx, query, shopId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []ShopApprovalEvent{}
+	for rows.Next() {
+		var e ShopApprovalEvent
+		err := rows.Scan(&e.Id, &e.ShopId, &e.ActorId, &e.From, &e.To, &e.Reason, &e.Created_At)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
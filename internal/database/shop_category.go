@@ -3,7 +3,13 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type ShopCategoryModel struct {
@@ -34,3 +40,237 @@ func (scm ShopCategoryModel) Delete(shop_id int, category_member_id int) error {
 	_, err := scm.db.ExecContext(ctx, query, shop_id, category_member_id)
 	return err
 }
+
+var (
+	ErrUnknownCategoryMember   = errors.New("unknown category member")
+	ErrAmbiguousCategoryMember = errors.New("ambiguous category member")
+)
+
+// ShopCategoryMember is a category member as embedded in a shop, labelled in
+// the requested locale.
+type ShopCategoryMember struct {
+	Slug  string `json:"slug"`
+	Label string `json:"label"`
+}
+
+// ShopCategories are a shop's category members grouped by category slug, e.g.
+// {"brand": [{"slug": "toyota", "label": "Toyota"}]}.
+type ShopCategories map[string][]ShopCategoryMember
+
+// Scan reads the JSON object built by shopCategoriesColumn.
+func (c *ShopCategories) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into ShopCategories", src)
+	}
+	return json.Unmarshal(b, c)
+}
+
+// shopCategoriesColumn selects the categories of the shop in the enclosing
+// query's shops row as a ShopCategories object, labelled for the locale bound
+// to the given placeholder.
+func shopCategoriesColumn(locale string) string {
+	return fmt.Sprintf(`COALESCE((
+	SELECT jsonb_object_agg(grouped.category, grouped.members)
+	FROM (
+		SELECT categories.slug AS category,
+			jsonb_agg(jsonb_build_object('slug', category_members.slug, 'label', %s) ORDER BY category_members.slug) AS members
+		FROM shop_categories
+		INNER JOIN category_members ON shop_categories.category_member_id = category_members.id
+		INNER JOIN categories ON category_members.category_id = categories.id
+		WHERE shop_categories.shop_id = shops.id
+		GROUP BY categories.slug
+	) AS grouped
+), '{}'::jsonb)`, categoryMemberLabel(locale))
+}
+
+// CategoryMemberRef names a category member in a shop's category list. JSON
+// numbers are member ids; strings are member slugs, optionally qualified by
+// the category slug, e.g. "toyota" or "brand:toyota".
+type CategoryMemberRef struct {
+	Id       int64
+	Category string
+	Slug     string
+}
+
+func (ref *CategoryMemberRef) UnmarshalJSON(b []byte) error {
+	var id int64
+	if err := json.Unmarshal(b, &id); err == nil {
+		*ref = CategoryMemberRef{Id: id}
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil || strings.TrimSpace(s) == "" {
+		return fmt.Errorf("category must contain member ids or slugs, not %s", b)
+	}
+
+	*ref = ParseCategoryMemberRef(s)
+	return nil
+}
+
+// ParseCategoryMemberRef reads a slug, optionally qualified by the category
+// slug as in "brand:toyota". Slugs are lowercased.
+func ParseCategoryMemberRef(s string) CategoryMemberRef {
+	slug := strings.ToLower(strings.TrimSpace(s))
+	category, member, qualified := strings.Cut(slug, ":")
+	if !qualified {
+		return CategoryMemberRef{Slug: slug}
+	}
+	return CategoryMemberRef{Category: strings.TrimSpace(category), Slug: strings.TrimSpace(member)}
+}
+
+func (ref CategoryMemberRef) String() string {
+	switch {
+	case ref.Slug == "":
+		return fmt.Sprint(ref.Id)
+	case ref.Category == "":
+		return ref.Slug
+	default:
+		return ref.Category + ":" + ref.Slug
+	}
+}
+
+// CheckMemberFilter sorts the refs of a category_members filter that can't be
+// applied into unknown and ambiguous ones. A qualified ref must name a member
+// of the category or its subcategories. An unqualified one must name exactly
+// one category or one member; member slugs are only unique per category.
+func (cm CategoryModel) CheckMemberFilter(refs []CategoryMemberRef) ([]string, []string, error) {
+	unknown, ambiguous := []string{}, []string{}
+	if len(refs) == 0 {
+		return unknown, ambiguous, nil
+	}
+
+	categories, slugs := []string{}, []string{}
+	for _, ref := range refs {
+		categories = append(categories, ref.Category)
+		slugs = append(slugs, ref.Slug)
+	}
+
+	query := `
+	SELECT
+		(SELECT count(*) FROM categories WHERE refs.category = '' AND categories.slug = refs.slug) +
+		(SELECT count(*)
+		FROM category_members
+		INNER JOIN categories ON category_members.category_id = categories.id
+		WHERE category_members.slug = refs.slug
+		AND (refs.category = '' OR categories.path <@ ARRAY(SELECT path FROM categories WHERE slug = refs.category)))
+	FROM unnest($1::text[], $2::text[]) WITH ORDINALITY AS refs(category, slug, n)
+	ORDER BY refs.n`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := cm.db.QueryContext(ctx, query, pq.Array(categories), pq.Array(slugs))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for i := 0; rows.Next(); i++ {
+		var matches int
+		if err := rows.Scan(&matches); err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case matches == 0:
+			unknown = append(unknown, refs[i].String())
+		case matches > 1 && refs[i].Category == "":
+			ambiguous = append(ambiguous, refs[i].String())
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return unknown, ambiguous, nil
+}
+
+// resolveCategoryMembers turns refs into member ids. It returns
+// ErrUnknownCategoryMember if any slug doesn't name a member, and
+// ErrAmbiguousCategoryMember if an unqualified slug names members of several
+// categories.
+func resolveCategoryMembers(ctx context.Context, tx *sql.Tx, refs []CategoryMemberRef) ([]int64, error) {
+	ids := []int64{}
+	categories, slugs := []string{}, []string{}
+	for _, ref := range refs {
+		if ref.Slug == "" {
+			ids = append(ids, ref.Id)
+			continue
+		}
+		categories = append(categories, ref.Category)
+		slugs = append(slugs, ref.Slug)
+	}
+
+	if len(slugs) == 0 {
+		return ids, nil
+	}
+
+	query := `
+	SELECT min(category_members.id), count(category_members.id)
+	FROM unnest($1::text[], $2::text[]) WITH ORDINALITY AS refs(category, slug, n)
+	LEFT JOIN (category_members INNER JOIN categories ON categories.id = category_members.category_id)
+		ON category_members.slug = refs.slug AND (refs.category = '' OR categories.slug = refs.category)
+	GROUP BY refs.n`
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(categories), pq.Array(slugs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id      sql.NullInt64
+			matches int
+		)
+		if err := rows.Scan(&id, &matches); err != nil {
+			return nil, err
+		}
+		switch {
+		case matches == 0:
+			return nil, ErrUnknownCategoryMember
+		case matches > 1:
+			return nil, ErrAmbiguousCategoryMember
+		}
+		ids = append(ids, id.Int64)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// replaceShopCategories swaps the shop's category members for refs as part of
+// tx.
+func replaceShopCategories(ctx context.Context, tx *sql.Tx, shopId int, refs []CategoryMemberRef) error {
+	memberIds, err := resolveCategoryMembers(ctx, tx, refs)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM shop_categories WHERE shop_id = $1`, shopId)
+	if err != nil {
+		return err
+	}
+
+	if len(memberIds) == 0 {
+		return nil
+	}
+
+	query := `
+	INSERT INTO shop_categories (shop_id, category_member_id)
+	SELECT DISTINCT $1::int, unnest($2::int[])`
+
+	_, err = tx.ExecContext(ctx, query, shopId, pq.Array(memberIds))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "shop_categories_category_member_id_fkey"):
+			return ErrUnknownCategoryMember
+		default:
+			return err
+		}
+	}
+	return nil
+}
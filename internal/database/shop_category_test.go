@@ -0,0 +1,89 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCategoryMemberRefUnmarshal(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []CategoryMemberRef
+		valid bool
+	}{
+		{"ids", `[1, 2]`, []CategoryMemberRef{{Id: 1}, {Id: 2}}, true},
+		{"slugs", `["toyota", " Brand:Toyota "]`, []CategoryMemberRef{{Slug: "toyota"}, {Category: "brand", Slug: "toyota"}}, true},
+		{"mixed", `[1, "tires"]`, []CategoryMemberRef{{Id: 1}, {Slug: "tires"}}, true},
+		{"empty string", `[""]`, nil, false},
+		{"fractional id", `[1.5]`, nil, false},
+		{"boolean", `[true]`, nil, false},
+		{"object", `[{"id": 1}]`, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input struct {
+				Category []CategoryMemberRef `json:"category"`
+			}
+			err := json.Unmarshal([]byte(`{"category": `+tt.input+`}`), &input)
+
+			if !tt.valid {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", input.Category)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(input.Category, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, input.Category)
+			}
+		})
+	}
+}
+
+func TestParseCategoryMemberRef(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   CategoryMemberRef
+		String string
+	}{
+		{"toyota", CategoryMemberRef{Slug: "toyota"}, "toyota"},
+		{" Other ", CategoryMemberRef{Slug: "other"}, "other"},
+		{"service:other", CategoryMemberRef{Category: "service", Slug: "other"}, "service:other"},
+		{" Brand : Other ", CategoryMemberRef{Category: "brand", Slug: "other"}, "brand:other"},
+	}
+
+	for _, tt := range tests {
+		got := ParseCategoryMemberRef(tt.input)
+		if got != tt.want {
+			t.Errorf("ParseCategoryMemberRef(%q): expected %+v, got %+v", tt.input, tt.want, got)
+		}
+		if got.String() != tt.String {
+			t.Errorf("ParseCategoryMemberRef(%q).String(): expected %q, got %q", tt.input, tt.String, got.String())
+		}
+	}
+}
+
+func TestShopCategoriesScan(t *testing.T) {
+	var c ShopCategories
+	err := c.Scan([]byte(`{"brand": [{"slug": "toyota", "label": "ቶዮታ"}], "service": [{"slug": "other", "label": "Other"}]}`))
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	want := ShopCategories{
+		"brand":   {{Slug: "toyota", Label: "ቶዮታ"}},
+		"service": {{Slug: "other", Label: "Other"}},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("expected %+v, got %+v", want, c)
+	}
+
+	if err := c.Scan("{}"); err == nil {
+		t.Error("expected scanning a string to fail")
+	}
+}
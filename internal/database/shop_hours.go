@@ -0,0 +1,260 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	_ "time/tzdata" // shop timezones must resolve even without system zoneinfo
+
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+// ErrUnknownTimezone is returned when Postgres doesn't know a timezone Go
+// accepted. open_now and open_at convert with AT TIME ZONE shops.timezone, so
+// one such name would break every listing that filters on opening hours.
+var ErrUnknownTimezone = errors.New("unknown timezone")
+
+// OpeningInterval is one stretch of a weekday the shop is open, in the
+// shop's local time. Weekday 0 is Sunday. Opens and Closes are "HH:MM";
+// Closes may be "24:00". Overnight opening is two intervals, one either side
+// of midnight.
+type OpeningInterval struct {
+	Weekday int    `json:"weekday"`
+	Opens   string `json:"opens"`
+	Closes  string `json:"closes"`
+}
+
+// ShopClosure is a run of whole days, both inclusive, the shop is closed
+// regardless of its weekly hours. Dates are "YYYY-MM-DD".
+type ShopClosure struct {
+	Id        int64  `json:"id"`
+	Starts_On string `json:"starts_on"`
+	Ends_On   string `json:"ends_on"`
+	Reason    string `json:"reason"`
+}
+
+type ShopHours struct {
+	Timezone string            `json:"timezone"`
+	Hours    []OpeningInterval `json:"hours"`
+	Closures []ShopClosure     `json:"closures"`
+}
+
+// minuteOfDay parses "HH:MM" into minutes past midnight, allowing "24:00".
+// Both fields must be exactly two digits.
+func minuteOfDay(s string) (int, bool) {
+	if len(s) != 5 || s[2] != ':' {
+		return 0, false
+	}
+	for _, i := range []int{0, 1, 3, 4} {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+	}
+
+	h := int(s[0]-'0')*10 + int(s[1]-'0')
+	m := int(s[3]-'0')*10 + int(s[4]-'0')
+	if m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, false
+	}
+	return h*60 + m, true
+}
+
+const maxIntervalsPerDay = 6
+
+func ValidateShopHours(v *validator.Validator, h *ShopHours) {
+	// "Local" resolves in Go to the server's own zone but means nothing to
+	// Postgres.
+	_, err := time.LoadLocation(h.Timezone)
+	v.Check(h.Timezone != "" && h.Timezone != "Local" && err == nil, "timezone", "must be an IANA time zone such as Africa/Addis_Ababa")
+
+	type span struct{ opens, closes int }
+	byDay := map[int][]span{}
+
+	for _, interval := range h.Hours {
+		opens, okOpens := minuteOfDay(interval.Opens)
+		closes, okCloses := minuteOfDay(interval.Closes)
+
+		v.Check(interval.Weekday >= 0 && interval.Weekday <= 6, "hours", "weekday must be between 0 (Sunday) and 6 (Saturday)")
+		v.Check(okOpens && okCloses, "hours", "opens and closes must be times formatted as HH:MM")
+		if !okOpens || !okCloses {
+			continue
+		}
+		v.Check(opens < closes, "hours", "an interval must close after it opens")
+		byDay[interval.Weekday] = append(byDay[interval.Weekday], span{opens, closes})
+	}
+
+	for _, spans := range byDay {
+		v.Check(len(spans) <= maxIntervalsPerDay, "hours", fmt.Sprintf("must not have more than %d intervals per day", maxIntervalsPerDay))
+
+		sort.Slice(spans, func(i, j int) bool { return spans[i].opens < spans[j].opens })
+		for i := 1; i < len(spans); i++ {
+			v.Check(spans[i].opens >= spans[i-1].closes, "hours", "intervals on the same day must not overlap")
+		}
+	}
+}
+
+func ValidateShopClosure(v *validator.Validator, c *ShopClosure) {
+	starts, errStarts := time.Parse(time.DateOnly, c.Starts_On)
+	ends, errEnds := time.Parse(time.DateOnly, c.Ends_On)
+
+	v.Check(errStarts == nil, "starts_on", "must be a date formatted as YYYY-MM-DD")
+	v.Check(errEnds == nil, "ends_on", "must be a date formatted as YYYY-MM-DD")
+	if errStarts == nil && errEnds == nil {
+		v.Check(!ends.Before(starts), "ends_on", "must not be before starts_on")
+	}
+	v.Check(len(c.Reason) <= 200, "reason", "must not be more than 200 bytes long")
+}
+
+type ShopHoursModel struct {
+	db *sql.DB
+}
+
+// Get returns the shop's timezone, weekly hours and the closures that haven't
+// ended yet.
+func (m ShopHoursModel) Get(shopId int64) (*ShopHours, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	hours := &ShopHours{Hours: []OpeningInterval{}, Closures: []ShopClosure{}}
+
+	err := m.db.QueryRowContext(ctx, `SELECT timezone FROM shops WHERE id = $1`, shopId).Scan(&hours.Timezone)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query := `
+	SELECT weekday, to_char(opens_at, 'HH24:MI'), to_char(closes_at, 'HH24:MI')
+	FROM shop_hours
+	WHERE shop_id = $1
+	ORDER BY weekday, opens_at`
+
+	rows, err := m.db.QueryContext(ctx, query, shopId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var interval OpeningInterval
+		if err := rows.Scan(&interval.Weekday, &interval.Opens, &interval.Closes); err != nil {
+			return nil, err
+		}
+		hours.Hours = append(hours.Hours, interval)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT id, to_char(starts_on, 'YYYY-MM-DD'), to_char(ends_on, 'YYYY-MM-DD'), reason
+	FROM shop_closures
+	WHERE shop_id = $1 AND ends_on >= CURRENT_DATE
+	ORDER BY starts_on`
+
+	rows, err = m.db.QueryContext(ctx, query, shopId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var closure ShopClosure
+		if err := rows.Scan(&closure.Id, &closure.Starts_On, &closure.Ends_On, &closure.Reason); err != nil {
+			return nil, err
+		}
+		hours.Closures = append(hours.Closures, closure)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hours, nil
+}
+
+// Replace sets the shop's timezone and swaps its weekly hours for h.Hours.
+// Closures are managed separately. It returns ErrUnknownTimezone if Postgres
+// doesn't list h.Timezone in pg_timezone_names.
+func (m ShopHoursModel) Replace(shopId int64, h *ShopHours) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var known bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM pg_timezone_names WHERE name = $1)`, h.Timezone).Scan(&known)
+	if err != nil {
+		return err
+	}
+	if !known {
+		return ErrUnknownTimezone
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE shops SET timezone = $1 WHERE id = $2`, h.Timezone, shopId)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM shop_hours WHERE shop_id = $1`, shopId); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO shop_hours (shop_id, weekday, opens_at, closes_at) VALUES ($1, $2, $3, $4)`
+	for _, interval := range h.Hours {
+		if _, err = tx.ExecContext(ctx, query, shopId, interval.Weekday, interval.Opens, interval.Closes); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m ShopHoursModel) AddClosure(shopId int64, c *ShopClosure) error {
+	query := `
+	INSERT INTO shop_closures (shop_id, starts_on, ends_on, reason)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.db.QueryRowContext(ctx, query, shopId, c.Starts_On, c.Ends_On, c.Reason).Scan(&c.Id)
+}
+
+func (m ShopHoursModel) DeleteClosure(shopId, id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.db.ExecContext(ctx, `DELETE FROM shop_closures WHERE id = $1 AND shop_id = $2`, id, shopId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+func TestMinuteOfDay(t *testing.T) {
+	tests := []struct {
+		input  string
+		minute int
+		ok     bool
+	}{
+		{"00:00", 0, true},
+		{"09:30", 570, true},
+		{"23:59", 1439, true},
+		{"24:00", 1440, true},
+		{"24:01", 0, false},
+		{"25:00", 0, false},
+		{"12:60", 0, false},
+		{"9:00", 0, false},
+		{" 9:00", 0, false},
+		{"+1:00", 0, false},
+		{"1:300", 0, false},
+		{"09:3a", 0, false},
+		{"09.30", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			minute, ok := minuteOfDay(tt.input)
+			if ok != tt.ok || minute != tt.minute {
+				t.Errorf("expected (%d, %t), got (%d, %t)", tt.minute, tt.ok, minute, ok)
+			}
+		})
+	}
+}
+
+func TestValidateShopHours(t *testing.T) {
+	interval := func(weekday int, opens, closes string) OpeningInterval {
+		return OpeningInterval{Weekday: weekday, Opens: opens, Closes: closes}
+	}
+	repeat := func(weekday, n int) []OpeningInterval {
+		hours := []OpeningInterval{}
+		for i := 0; i < n; i++ {
+			hours = append(hours, interval(weekday, fmt.Sprintf("%02d:00", i), fmt.Sprintf("%02d:30", i)))
+		}
+		return hours
+	}
+
+	tests := []struct {
+		name     string
+		timezone string
+		hours    []OpeningInterval
+		valid    bool
+	}{
+		{"no hours", "Africa/Addis_Ababa", nil, true},
+		{"split day", "Africa/Addis_Ababa", []OpeningInterval{interval(1, "08:00", "12:00"), interval(1, "13:00", "17:00")}, true},
+		{"touching intervals", "Africa/Addis_Ababa", []OpeningInterval{interval(1, "08:00", "12:00"), interval(1, "12:00", "17:00")}, true},
+		{"overlapping intervals", "Africa/Addis_Ababa", []OpeningInterval{interval(1, "08:00", "12:30"), interval(1, "12:00", "17:00")}, false},
+		{"overlap listed out of order", "Africa/Addis_Ababa", []OpeningInterval{interval(1, "12:00", "17:00"), interval(1, "08:00", "12:30")}, false},
+		{"same times on different days", "Africa/Addis_Ababa", []OpeningInterval{interval(1, "08:00", "17:00"), interval(2, "08:00", "17:00")}, true},
+		{"open until midnight", "Africa/Addis_Ababa", []OpeningInterval{interval(5, "18:00", "24:00"), interval(6, "00:00", "02:00")}, true},
+		{"opens at 24:00", "Africa/Addis_Ababa", []OpeningInterval{interval(5, "24:00", "24:00")}, false},
+		{"closes before it opens", "Africa/Addis_Ababa", []OpeningInterval{interval(1, "17:00", "08:00")}, false},
+		{"empty interval", "Africa/Addis_Ababa", []OpeningInterval{interval(1, "08:00", "08:00")}, false},
+		{"bad format", "Africa/Addis_Ababa", []OpeningInterval{interval(1, "8:00", "17:00")}, false},
+		{"weekday out of range", "Africa/Addis_Ababa", []OpeningInterval{interval(7, "08:00", "17:00")}, false},
+		{"six intervals in a day", "Africa/Addis_Ababa", repeat(1, 6), true},
+		{"seven intervals in a day", "Africa/Addis_Ababa", repeat(1, 7), false},
+		{"six intervals on every day", "Africa/Addis_Ababa", append(append(repeat(0, 6), repeat(1, 6)...), repeat(2, 6)...), true},
+		{"missing timezone", "", nil, false},
+		{"unknown timezone", "Africa/Atlantis", nil, false},
+		{"server local timezone", "Local", nil, false},
+		{"UTC", "UTC", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateShopHours(v, &ShopHours{Timezone: tt.timezone, Hours: tt.hours})
+			if v.Valid() != tt.valid {
+				t.Errorf("expected valid=%t, got errors %v", tt.valid, v.Errors)
+			}
+		})
+	}
+}
+
+func TestValidateShopClosure(t *testing.T) {
+	tests := []struct {
+		name    string
+		closure ShopClosure
+		valid   bool
+	}{
+		{"single day", ShopClosure{Starts_On: "2025-01-07", Ends_On: "2025-01-07"}, true},
+		{"several days", ShopClosure{Starts_On: "2025-01-07", Ends_On: "2025-01-19", Reason: "Timket"}, true},
+		{"ends before it starts", ShopClosure{Starts_On: "2025-01-07", Ends_On: "2025-01-06"}, false},
+		{"bad date", ShopClosure{Starts_On: "07/01/2025", Ends_On: "2025-01-07"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateShopClosure(v, &tt.closure)
+			if v.Valid() != tt.valid {
+				t.Errorf("expected valid=%t, got errors %v", tt.valid, v.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package database
+
+import "testing"
+
+func TestMarkHighlight(t *testing.T) {
+	tests := []struct {
+		name      string
+		headline  string
+		highlight string
+	}{
+		{"plain", "\x02Abebe\x03 Garage - Bole", "<mark>Abebe</mark> Garage - Bole"},
+		{"markup in the name", "<img src=x onerror=alert(1)> \x02Garage\x03", "&lt;img src=x onerror=alert(1)&gt; <mark>Garage</mark>"},
+		{"quotes and ampersands", "Tom & Jerry's \"\x02Tyres\x03\"", "Tom &amp; Jerry&#39;s &#34;<mark>Tyres</mark>&#34;"},
+		{"no match", "Bole Auto - Bole", "Bole Auto - Bole"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markHighlight(tt.headline); got != tt.highlight {
+				t.Errorf("expected %q, got %q", tt.highlight, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Suggestion is one search bar autocomplete entry. Type is shop,
+// category_member or location; ShopId is only set for shop suggestions.
+type Suggestion struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	ShopId *int64 `json:"shop_id,omitempty"`
+}
+
+type SearchModel struct {
+	db *sql.DB
+}
+
+// likeEscaper escapes LIKE wildcards so user input only ever matches
+// literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Suggest returns up to limit suggestions for what the user has typed so far.
+// Prefix matches rank above trigram matches; only approved shops, and the
+// category labels, in any locale, and locations of approved shops, are
+// suggested.
+func (m SearchModel) Suggest(q string, limit int) ([]Suggestion, error) {
+	query := `
+	SELECT type, text, shop_id FROM (
+		(SELECT 'shop' AS type, name AS text, id::bigint AS shop_id,
+			(lower(name) LIKE $1)::int + similarity(name, $2) AS score
+		FROM shops
+		WHERE approval_status = 'APPROVED' AND (lower(name) LIKE $1 OR name % $2)
+		ORDER BY score DESC
+		LIMIT $3)
+		UNION ALL
+		(SELECT 'category_member', labels.label, NULL,
+			MAX((lower(labels.label) LIKE $1)::int + similarity(labels.label, $2)) AS score
+		FROM (
+			SELECT id AS category_member_id, value AS label FROM category_members
+			UNION ALL
+			SELECT category_member_id, label FROM category_member_translations
+		) AS labels
+		WHERE (lower(labels.label) LIKE $1 OR labels.label % $2)
+		AND EXISTS (
+			SELECT 1 FROM shop_categories
+			INNER JOIN shops ON shops.id = shop_categories.shop_id
+			WHERE shop_categories.category_member_id = labels.category_member_id
+			AND shops.approval_status = 'APPROVED')
+		GROUP BY labels.label
+		ORDER BY score DESC
+		LIMIT $3)
+		UNION ALL
+		(SELECT 'location', location, NULL,
+			MAX((lower(location) LIKE $1)::int + similarity(location, $2)) AS score
+		FROM shops
+		WHERE approval_status = 'APPROVED' AND (lower(location) LIKE $1 OR location % $2)
+		GROUP BY location
+		ORDER BY score DESC
+		LIMIT $3)
+	) AS suggestions
+	ORDER BY score DESC, text ASC
+	LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	prefix := likeEscaper.Replace(strings.ToLower(q)) + "%"
+
+	rows, err := m.db.QueryContext(ctx, query, prefix, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var suggestion Suggestion
+		if err := rows.Scan(&suggestion.Type, &suggestion.Text, &suggestion.ShopId); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
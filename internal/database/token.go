@@ -14,6 +14,8 @@ import (
 const (
 	ScopeActivation    = "activation"
 	ScopePasswordReset = "password_reset"
+	ScopeRefresh       = "refresh"
+	ScopeEmailChange   = "email_change"
 )
 
 type Token struct {
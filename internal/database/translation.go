@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+var (
+	ErrDuplicateSlug = errors.New("duplicate slug")
+)
+
+// DefaultLocale is used when a category has no label in the requested
+// locale. A category without a label in either falls back to its value.
+const DefaultLocale = "en"
+
+// SupportedLocales are the locales labels may be translated into.
+var SupportedLocales = []string{"en", "am"}
+
+var (
+	slugRegex      = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// Slugify derives a slug from a label, e.g. "Oil & Filters" becomes
+// "oil-filters". It returns "" when the label has no ASCII letters or digits.
+func Slugify(s string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+func ValidateSlug(v *validator.Validator, slug string) {
+	v.Check(slug != "", "slug", "must be provided")
+	v.Check(len(slug) <= 100, "slug", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(slug, slugRegex), "slug", "must be lowercase letters and digits separated by single hyphens")
+}
+
+func ValidateLabel(v *validator.Validator, locale, label string) {
+	v.Check(validator.In(locale, SupportedLocales...), "locale", fmt.Sprintf("must be one of %s", strings.Join(SupportedLocales, ", ")))
+	v.Check(label != "", "label", "must be provided")
+	v.Check(len(label) <= 200, "label", "must not be more than 200 bytes long")
+}
+
+// categoryLabel and categoryMemberLabel select the label of the categories or
+// category_members row in the enclosing query, for the locale bound to the
+// given placeholder.
+func categoryLabel(locale string) string {
+	return fmt.Sprintf(`COALESCE(
+		(SELECT label FROM category_translations WHERE category_id = categories.id AND locale = %s),
+		(SELECT label FROM category_translations WHERE category_id = categories.id AND locale = '%s'),
+		categories.value)`, locale, DefaultLocale)
+}
+
+func categoryMemberLabel(locale string) string {
+	return fmt.Sprintf(`COALESCE(
+		(SELECT label FROM category_member_translations WHERE category_member_id = category_members.id AND locale = %s),
+		(SELECT label FROM category_member_translations WHERE category_member_id = category_members.id AND locale = '%s'),
+		category_members.value)`, locale, DefaultLocale)
+}
+
+// setLabel adds or replaces a translation in table, which is keyed by
+// column and locale.
+func setLabel(db *sql.DB, table, column string, id int64, locale, label string) error {
+	query := fmt.Sprintf(`
+	INSERT INTO %[1]s (%[2]s, locale, label)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (%[2]s, locale) DO UPDATE SET label = EXCLUDED.label`, table, column)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, query, id, locale, label)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), table+"_"+column+"_fkey"):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteLabel(db *sql.DB, table, column string, id int64, locale string) error {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE %s = $1 AND locale = $2`, table, column)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, query, id, locale)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (cm CategoryModel) SetLabel(id int64, locale, label string) error {
+	return setLabel(cm.db, "category_translations", "category_id", id, locale, label)
+}
+
+func (cm CategoryModel) DeleteLabel(id int64, locale string) error {
+	return deleteLabel(cm.db, "category_translations", "category_id", id, locale)
+}
+
+func (cmm CategoryMemberModel) SetLabel(id int64, locale, label string) error {
+	return setLabel(cmm.db, "category_member_translations", "category_member_id", id, locale, label)
+}
+
+func (cmm CategoryMemberModel) DeleteLabel(id int64, locale string) error {
+	return deleteLabel(cmm.db, "category_member_translations", "category_member_id", id, locale)
+}
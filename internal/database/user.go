@@ -18,6 +18,8 @@ var (
 	ErrDuplicatePhoneNumber = errors.New("duplicate phone number")
 )
 
+// Role names a row of the roles table. The constants are the roles seeded by
+// migration; others can be created at runtime.
 type Role string
 
 const (
@@ -27,15 +29,15 @@ const (
 )
 
 type User struct {
-	Id            int64     `json:"id"`
-	Name          string    `json:"name"`
-	Email         string    `json:"email"`
-	Is_Verified   bool      `json:"is_verified"`
-	Password      password  `json:"-"`
-	Phone_Number  string    `json:"phone_number"`
-	Role          Role      `json:"role"`
-	Created_At    time.Time `json:"-"`
-	Refresh_Token *string   `json:"refresh_token"`
+	Id           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	Is_Verified  bool      `json:"is_verified"`
+	Password     password  `json:"-"`
+	Phone_Number string    `json:"phone_number"`
+	Role         Role      `json:"role"`
+	MFA_Enabled  bool      `json:"mfa_enabled"`
+	Created_At   time.Time `json:"-"`
 }
 
 func ValidateUser(v *validator.Validator, u *User) {
@@ -50,6 +52,12 @@ func ValidateUser(v *validator.Validator, u *User) {
 	v.Check(u.Role != "", "role", "role must not be empty")
 }
 
+func ValidatePasswordPlaintext(v *validator.Validator, key, password string) {
+	v.Check(password != "", key, "must be provided")
+	v.Check(len(password) >= 8, key, "must be at least 8 bytes long")
+	v.Check(len(password) <= 72, key, "must not be more than 72 bytes long")
+}
+
 type UserModel struct {
 	db *sql.DB
 }
@@ -82,6 +90,14 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("autosphere-timing-equalizer"), 12)
+
+// SimulatePasswordCheck spends the same time as a real bcrypt comparison so
+// that logins for unknown emails can't be told apart by response time.
+func SimulatePasswordCheck(plaintextPassword string) {
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(plaintextPassword))
+}
+
 func (um UserModel) Create(user *User) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -100,6 +116,8 @@ func (um UserModel) Create(user *User) error {
 			return ErrDuplicateEmail
 		case strings.Contains(err.Error(), "users_phone_number_key"):
 			return ErrDuplicatePhoneNumber
+		case strings.Contains(err.Error(), "users_role_fkey"):
+			return ErrUnknownRole
 		default:
 			return err
 		}
@@ -111,9 +129,9 @@ func (um UserModel) GetByEmail(email string) (User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `SELECT id, name, email, phone_number, role, password, refresh_token FROM users WHERE email=$1`
+	query := `SELECT id, name, email, phone_number, role, password, is_verified, totp_enabled FROM users WHERE email=$1`
 	var user User
-	err := um.db.QueryRowContext(ctx, query, email).Scan(&user.Id, &user.Name, &user.Email, &user.Phone_Number, &user.Role, &user.Password.hash, &user.Refresh_Token)
+	err := um.db.QueryRowContext(ctx, query, email).Scan(&user.Id, &user.Name, &user.Email, &user.Phone_Number, &user.Role, &user.Password.hash, &user.Is_Verified, &user.MFA_Enabled)
 
 	if err != nil {
 		switch {
@@ -132,7 +150,7 @@ func (um UserModel) Get(id int64) (*User, error) {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `SELECT id, name, email, phone_number, role FROM users WHERE id=$1`
+	query := `SELECT id, name, email, phone_number, role, password, is_verified, totp_enabled FROM users WHERE id=$1`
 
 	var user User
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -140,9 +158,8 @@ func (um UserModel) Get(id int64) (*User, error) {
 	defer cancel()
 
 	err := um.db.QueryRowContext(ctx, query, id).Scan(
-		&user.Id, &user.Name, &user.Email, &user.Phone_Number, &user.Role,
+		&user.Id, &user.Name, &user.Email, &user.Phone_Number, &user.Role, &user.Password.hash, &user.Is_Verified, &user.MFA_Enabled,
 	)
-	fmt.Print("Error 1", err)
 
 	if err != nil {
 		switch {
@@ -163,14 +180,13 @@ func (um UserModel) Patch(user *User) error {
 
 	defer cancel()
 
-	query := `UPDATE users SET name=$1, email=$2, phone_number=$3, role=$4, refresh_token=$5, is_verified=$6, password=$7 WHERE id=$8 RETURNING id, name, email, phone_number, role, is_verified`
+	query := `UPDATE users SET name=$1, email=$2, phone_number=$3, role=$4, is_verified=$5, password=$6 WHERE id=$7 RETURNING id, name, email, phone_number, role, is_verified`
 
 	args := []interface{}{
 		user.Name,
 		user.Email,
 		user.Phone_Number,
 		user.Role,
-		user.Refresh_Token,
 		user.Is_Verified,
 		user.Password.hash,
 		user.Id,
@@ -184,6 +200,8 @@ func (um UserModel) Patch(user *User) error {
 			return ErrDuplicateEmail
 		case strings.Contains(err.Error(), "users_phone_number_key"):
 			return ErrDuplicatePhoneNumber
+		case strings.Contains(err.Error(), "users_role_fkey"):
+			return ErrUnknownRole
 		default:
 			return err
 		}
@@ -226,7 +244,7 @@ func (um UserModel) GetAll(name string, role string, filters Filters) ([]User, M
 	query := fmt.Sprintf(`SELECT count(*) OVER(), id, name, email, phone_number, role, created_at
 			  FROM users
 			  WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
-			  AND ($2 = '' OR role = $2::role)
+			  AND ($2 = '' OR role = $2)
 			  ORDER BY %s %s, id ASC
 			  LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 
@@ -268,27 +286,6 @@ func (um UserModel) GetAll(name string, role string, filters Filters) ([]User, M
 	return users, metadata, nil
 }
 
-func (um UserModel) GetByRefreshToken(refreshToken string) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `SELECT id, role from users
-			  WHERE refresh_token=$1`
-	var user User
-	err := um.db.QueryRowContext(ctx, query, refreshToken).Scan(&user.Id, &user.Role)
-
-	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return nil, ErrRecordNotFound
-		default:
-			return nil, err
-		}
-
-	}
-
-	return &user, nil
-}
 func (um UserModel) GetToken(hashText [32]byte, scope string, expiry time.Time) (*User, error) {
 
 	query := `SELECT id, name, email, password, is_verified, phone_number, role, created_at
@@ -319,3 +316,37 @@ func (um UserModel) GetToken(hashText [32]byte, scope string, expiry time.Time)
 	return &user, nil
 
 }
+
+// SetPendingEmail stores the address the user wants to switch to. It only
+// becomes their email once ConfirmEmailChange is called.
+func (um UserModel) SetPendingEmail(id int64, email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE users SET pending_email=$1 WHERE id=$2`
+	_, err := um.db.ExecContext(ctx, query, email, id)
+	return err
+}
+
+func (um UserModel) ConfirmEmailChange(id int64) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE users SET email=pending_email, pending_email=NULL
+			  WHERE id=$1 AND pending_email IS NOT NULL
+			  RETURNING email`
+
+	var email string
+	err := um.db.QueryRowContext(ctx, query, id).Scan(&email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		case strings.Contains(err.Error(), "users_email_key"):
+			return "", ErrDuplicateEmail
+		default:
+			return "", err
+		}
+	}
+	return email, nil
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+func (ser Server) apiKeyCreate(w http.ResponseWriter, r *http.Request) {
+	userId, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name   string     `json:"name"`
+		Scopes []string   `json:"scopes"`
+		Expiry *time.Time `json:"expiry"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if _, err = ser.models.Users.Get(userId); err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	key := database.APIKey{
+		UserId: userId,
+		Name:   input.Name,
+		Scopes: input.Scopes,
+		Expiry: input.Expiry,
+	}
+
+	v := validator.New()
+	if database.ValidateAPIKey(v, &key); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err = ser.models.APIKeys.New(&key); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/users/%d/api-keys/%d", userId, key.Id))
+	err = ser.writeJSON(w, http.StatusCreated, envelope{"api_key": key}, headers)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) apiKeyGetAll(w http.ResponseWriter, r *http.Request) {
+	userId, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	keys, err := ser.models.APIKeys.GetAllForUser(userId)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"api_keys": keys}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) apiKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	userId, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+	keyId, err := ser.readIntParam(r, "keyId")
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	if err = ser.models.APIKeys.Revoke(userId, keyId); err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"message": "api key successfully revoked"}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
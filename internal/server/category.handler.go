@@ -6,12 +6,15 @@ import (
 	"net/http"
 
 	"github.com/Mahider-T/autoSphere/internal/database"
+	"github.com/Mahider-T/autoSphere/validator"
 )
 
 func (ser Server) catCreate(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Id    int    `json:"id"`
-		Value string `json:"value"`
+		Id       int    `json:"id"`
+		Value    string `json:"value"`
+		Slug     string `json:"slug"`
+		ParentId *int   `json:"parent_id"`
 	}
 
 	err := ser.readJSON(w, r, &input)
@@ -20,11 +23,32 @@ func (ser Server) catCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	cat := database.Category{
-		Id:    input.Id,
-		Value: input.Value,
+		Id:       input.Id,
+		Value:    input.Value,
+		Slug:     input.Slug,
+		ParentId: input.ParentId,
 	}
+	if cat.Slug == "" {
+		cat.Slug = database.Slugify(cat.Value)
+	}
+
+	v := validator.New()
+	if database.ValidateSlug(v, cat.Slug); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	if err = ser.models.Category.Create(&cat); err != nil {
-		ser.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, database.ErrUnknownParentCategory):
+			v.AddError("parent_id", "category does not exist")
+			ser.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, database.ErrDuplicateSlug):
+			v.AddError("slug", "a category with this slug already exists")
+			ser.failedValidationResponse(w, r, v.Errors)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 	headers := make(http.Header)
@@ -41,7 +65,7 @@ func (ser Server) catGetOne(w http.ResponseWriter, r *http.Request) {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
-	cat, err := ser.models.Category.Get(id)
+	cat, err := ser.models.Category.Get(id, requestLocale(r))
 	if err != nil {
 		if errors.Is(err, database.ErrRecordNotFound) {
 			ser.notFoundResponse(w, r)
@@ -50,11 +74,12 @@ func (ser Server) catGetOne(w http.ResponseWriter, r *http.Request) {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
+	w.Header().Add("Vary", "Accept-Language")
 	ser.writeJSON(w, http.StatusOK, envelope{"category": cat}, nil)
 }
 
 func (ser Server) catGetAll(w http.ResponseWriter, r *http.Request) {
-	cats, total, err := ser.models.Category.GetAll()
+	cats, total, err := ser.models.Category.GetAll(requestLocale(r))
 	if err != nil {
 		if errors.Is(err, database.ErrRecordNotFound) {
 			ser.notFoundResponse(w, r)
@@ -63,6 +88,7 @@ func (ser Server) catGetAll(w http.ResponseWriter, r *http.Request) {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
+	w.Header().Add("Vary", "Accept-Language")
 	err = ser.writeJSON(w, http.StatusOK, envelope{"total": total, "categoreis": cats}, nil)
 	if err != nil {
 		ser.serverErrorResponse(w, r, err)
@@ -77,7 +103,9 @@ func (ser Server) catPut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cat, err := ser.models.Category.Get(id)
+	locale := requestLocale(r)
+
+	cat, err := ser.models.Category.Get(id, locale)
 	if err != nil {
 		switch {
 		case errors.Is(err, database.ErrRecordNotFound):
@@ -89,7 +117,8 @@ func (ser Server) catPut(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input struct {
-		Value string `json:"value"`
+		Value string  `json:"value"`
+		Slug  *string `json:"slug"`
 	}
 
 	err = ser.readJSON(w, r, &input)
@@ -99,9 +128,26 @@ func (ser Server) catPut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	cat.Value = input.Value
+	// The slug is left alone unless asked, so renaming a category doesn't
+	// break existing links.
+	if input.Slug != nil {
+		cat.Slug = *input.Slug
+	}
 
-	if err = ser.models.Category.Put(cat); err != nil {
-		ser.serverErrorResponse(w, r, err)
+	v := validator.New()
+	if database.ValidateSlug(v, cat.Slug); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err = ser.models.Category.Put(cat, locale); err != nil {
+		switch {
+		case errors.Is(err, database.ErrDuplicateSlug):
+			v.AddError("slug", "a category with this slug already exists")
+			ser.failedValidationResponse(w, r, v.Errors)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 	err = ser.writeJSON(w, http.StatusOK, envelope{"category": cat}, nil)
@@ -119,7 +165,7 @@ func (ser Server) catDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = ser.models.Category.Get(id)
+	_, err = ser.models.Category.Get(id, database.DefaultLocale)
 	if err != nil {
 		switch {
 		case errors.Is(err, database.ErrRecordNotFound):
@@ -131,7 +177,147 @@ func (ser Server) catDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err = ser.models.Category.Delete(id); err != nil {
+		switch {
+		case errors.Is(err, database.ErrCategoryHasChildren):
+			ser.conflictResponse(w, r, "category has subcategories; move or delete them first")
+		default:
+			ser.notFoundResponse(w, r)
+		}
+		return
+	}
+}
+
+// catMove reparents a category below parent_id, or makes it a root category
+// when parent_id is null. Its subcategories move with it.
+func (ser Server) catMove(w http.ResponseWriter, r *http.Request) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
 		ser.notFoundResponse(w, r)
 		return
 	}
+
+	var input struct {
+		ParentId *int `json:"parent_id"`
+	}
+
+	if err = ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if err = ser.models.Category.Move(id, input.ParentId); err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		case errors.Is(err, database.ErrUnknownParentCategory):
+			v.AddError("parent_id", "category does not exist")
+			ser.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, database.ErrCategoryCycle):
+			v.AddError("parent_id", "must not be the category itself or one of its subcategories")
+			ser.failedValidationResponse(w, r, v.Errors)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	cat, err := ser.models.Category.Get(id, requestLocale(r))
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"category": cat}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) catTree(w http.ResponseWriter, r *http.Request) {
+	tree, err := ser.models.Category.Tree(requestLocale(r))
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Language")
+	err = ser.writeJSON(w, http.StatusOK, envelope{"categories": tree}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+// catLabelPut sets the category's label in the {locale} path wildcard.
+func (ser Server) catLabelPut(w http.ResponseWriter, r *http.Request) {
+	ser.labelPut(w, r, ser.models.Category.SetLabel)
+}
+
+func (ser Server) catLabelDelete(w http.ResponseWriter, r *http.Request) {
+	ser.labelDelete(w, r, ser.models.Category.DeleteLabel)
+}
+
+// labelPut reads {"label": ...} and stores it for the {id} and {locale} path
+// wildcards with set.
+func (ser Server) labelPut(w http.ResponseWriter, r *http.Request, set func(id int64, locale, label string) error) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Label string `json:"label"`
+	}
+
+	if err = ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	locale := r.PathValue("locale")
+
+	v := validator.New()
+	if database.ValidateLabel(v, locale, input.Label); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err = set(id, locale, input.Label); err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"locale": locale, "label": input.Label}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) labelDelete(w http.ResponseWriter, r *http.Request, remove func(id int64, locale string) error) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	if err = remove(id, r.PathValue("locale")); err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"message": "label successfully deleted"}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
 }
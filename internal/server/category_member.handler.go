@@ -6,12 +6,14 @@ import (
 	"net/http"
 
 	"github.com/Mahider-T/autoSphere/internal/database"
+	"github.com/Mahider-T/autoSphere/validator"
 )
 
 func (ser Server) catMemberCreate(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Id         int    `json:"id"`
 		Value      string `json:"value"`
+		Slug       string `json:"slug"`
 		CategoryId int    `json:"category_id"`
 	}
 
@@ -23,10 +25,27 @@ func (ser Server) catMemberCreate(w http.ResponseWriter, r *http.Request) {
 	catMember := database.CategoryMember{
 		Id:         input.Id,
 		Value:      input.Value,
+		Slug:       input.Slug,
 		CategoryId: input.CategoryId,
 	}
+	if catMember.Slug == "" {
+		catMember.Slug = database.Slugify(catMember.Value)
+	}
+
+	v := validator.New()
+	if database.ValidateSlug(v, catMember.Slug); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	if err = ser.models.CategoryMember.Create(&catMember); err != nil {
-		ser.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, database.ErrDuplicateSlug):
+			v.AddError("slug", "a member of this category with this slug already exists")
+			ser.failedValidationResponse(w, r, v.Errors)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 	headers := make(http.Header)
@@ -44,7 +63,7 @@ func (ser Server) catMemberGetOne(w http.ResponseWriter, r *http.Request) {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
-	catMember, err := ser.models.CategoryMember.Get(id)
+	catMember, err := ser.models.CategoryMember.Get(id, requestLocale(r))
 	if err != nil {
 		if errors.Is(err, database.ErrRecordNotFound) {
 			ser.notFoundResponse(w, r)
@@ -53,11 +72,12 @@ func (ser Server) catMemberGetOne(w http.ResponseWriter, r *http.Request) {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
+	w.Header().Add("Vary", "Accept-Language")
 	ser.writeJSON(w, http.StatusOK, envelope{"category_member": catMember}, nil)
 }
 
 func (ser Server) catMemberGetAll(w http.ResponseWriter, r *http.Request) {
-	catMembers, total, err := ser.models.CategoryMember.GetAll()
+	catMembers, total, err := ser.models.CategoryMember.GetAll(requestLocale(r))
 	if err != nil {
 		if errors.Is(err, database.ErrRecordNotFound) {
 			ser.notFoundResponse(w, r)
@@ -66,6 +86,7 @@ func (ser Server) catMemberGetAll(w http.ResponseWriter, r *http.Request) {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
+	w.Header().Add("Vary", "Accept-Language")
 	err = ser.writeJSON(w, http.StatusOK, envelope{"total": total, "category_members": catMembers}, nil)
 	if err != nil {
 		ser.serverErrorResponse(w, r, err)
@@ -79,7 +100,9 @@ func (ser Server) catMemberPut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	catMember, err := ser.models.CategoryMember.Get(id)
+	locale := requestLocale(r)
+
+	catMember, err := ser.models.CategoryMember.Get(id, locale)
 	if err != nil {
 		switch {
 		case errors.Is(err, database.ErrRecordNotFound):
@@ -92,6 +115,7 @@ func (ser Server) catMemberPut(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
 		Value      *string `json:"value"`
+		Slug       *string `json:"slug"`
 		CategoryId *int    `json:"category_id"`
 	}
 
@@ -104,12 +128,28 @@ func (ser Server) catMemberPut(w http.ResponseWriter, r *http.Request) {
 		catMember.Value = *input.Value
 	}
 
+	if input.Slug != nil {
+		catMember.Slug = *input.Slug
+	}
+
 	if input.CategoryId != nil {
 		catMember.CategoryId = *input.CategoryId
 	}
 
-	if err = ser.models.CategoryMember.Patch(catMember); err != nil {
-		ser.serverErrorResponse(w, r, err)
+	v := validator.New()
+	if database.ValidateSlug(v, catMember.Slug); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err = ser.models.CategoryMember.Patch(catMember, locale); err != nil {
+		switch {
+		case errors.Is(err, database.ErrDuplicateSlug):
+			v.AddError("slug", "a member of this category with this slug already exists")
+			ser.failedValidationResponse(w, r, v.Errors)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 	err = ser.writeJSON(w, http.StatusOK, envelope{"category_member": catMember}, nil)
@@ -125,7 +165,7 @@ func (ser Server) catMemberDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = ser.models.CategoryMember.Get(id)
+	_, err = ser.models.CategoryMember.Get(id, database.DefaultLocale)
 	if err != nil {
 		switch {
 		case errors.Is(err, database.ErrRecordNotFound):
@@ -141,3 +181,11 @@ func (ser Server) catMemberDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func (ser Server) catMemberLabelPut(w http.ResponseWriter, r *http.Request) {
+	ser.labelPut(w, r, ser.models.CategoryMember.SetLabel)
+}
+
+func (ser Server) catMemberLabelDelete(w http.ResponseWriter, r *http.Request) {
+	ser.labelDelete(w, r, ser.models.CategoryMember.DeleteLabel)
+}
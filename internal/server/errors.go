@@ -2,7 +2,10 @@ package server
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (ser *Server) logError(r *http.Request, err error) {
@@ -40,6 +43,10 @@ func (ser *Server) methodNotAllowd(w http.ResponseWriter, r *http.Request) {
 	ser.errorResponse(w, r, http.StatusMethodNotAllowed, message)
 }
 
+func (ser *Server) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	ser.errorResponse(w, r, http.StatusBadRequest, err.Error())
+}
+
 func (ser *Server) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	ser.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
@@ -62,3 +69,50 @@ func (ser *Server) unauthorized(w http.ResponseWriter, r *http.Request) {
 	message := "Unauthorized"
 	ser.errorResponse(w, r, http.StatusUnauthorized, message)
 }
+
+func (ser *Server) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	message := "invalid or missing authentication token"
+	ser.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (ser *Server) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired refresh token"
+	ser.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (ser *Server) tooManyLoginAttemptsResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	message := "too many failed login attempts, please try again later"
+	ser.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+func (ser *Server) accountNotActivatedResponse(w http.ResponseWriter, r *http.Request) {
+	message := map[string]string{
+		"code":    "account_not_activated",
+		"message": "your user account must be activated before you can log in",
+	}
+	ser.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (ser *Server) mfaRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := map[string]string{
+		"code":    "mfa_required",
+		"message": "your role requires two-factor authentication, enroll and log in again with a one-time code",
+	}
+	ser.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (ser *Server) invalidOneTimeCodeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired one-time code"
+	ser.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (ser *Server) conflictResponse(w http.ResponseWriter, r *http.Request, message string) {
+	ser.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (ser *Server) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "rate limit exceeded, please try again later"
+	ser.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
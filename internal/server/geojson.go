@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+)
+
+const geoJSONContentType = "application/geo+json"
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type geoJSONFeature struct {
+	Type       string        `json:"type"`
+	Id         int           `json:"id"`
+	Geometry   geoJSONPoint  `json:"geometry"`
+	Properties database.Shop `json:"properties"`
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string              `json:"type"`
+	Features []geoJSONFeature    `json:"features"`
+	Metadata database.Metadata   `json:"metadata"`
+	Facets   database.ShopFacets `json:"facets,omitempty"`
+}
+
+// wantsGeoJSON reports whether the Accept header asks for GeoJSON.
+func wantsGeoJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == geoJSONContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// writeShopsGeoJSON writes the shops as a FeatureCollection of points. The
+// pagination metadata and any facet counts ride along as foreign members.
+func (ser *Server) writeShopsGeoJSON(w http.ResponseWriter, status int, shops []database.Shop, metadata database.Metadata, facets database.ShopFacets) error {
+	collection := geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: make([]geoJSONFeature, len(shops)),
+		Metadata: metadata,
+		Facets:   facets,
+	}
+	for i, shop := range shops {
+		collection.Features[i] = geoJSONFeature{
+			Type: "Feature",
+			Id:   shop.Id,
+			Geometry: geoJSONPoint{
+				Type:        "Point",
+				Coordinates: [2]float64{shop.Longitude, shop.Latitude},
+			},
+			Properties: shop,
+		}
+	}
+
+	js, err := json.MarshalIndent(collection, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	js = append(js, '\n')
+
+	w.Header().Set("Content-Type", geoJSONContentType)
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
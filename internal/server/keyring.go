@@ -0,0 +1,206 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is one entry of the keyring. Keys loaded only for verification
+// (previous keys kept around during a rotation window) have a nil private key.
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+type keyring struct {
+	current *signingKey
+	keys    map[string]*signingKey
+}
+
+// previousKey is one JWT_PREVIOUS_KEYS entry.
+type previousKey struct {
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Key string `json:"key"`
+}
+
+// newKeyring builds the keyring from configuration. alg is one of HS256, RS256
+// or EdDSA and key is either the HMAC secret or the path to a PEM encoded
+// private key. previous is a JSON array of {"kid", "alg", "key"} objects for
+// keys that are still accepted for verification but never used for signing;
+// JSON keeps secrets containing any character intact.
+func newKeyring(alg, kid, key, previous string) (*keyring, error) {
+	if kid == "" {
+		return nil, errors.New("JWT_SIGNING_KEY_ID must be set")
+	}
+	if key == "" {
+		return nil, errors.New("JWT_SIGNING_KEY must be set")
+	}
+
+	current, err := loadSigningKey(kid, alg, key)
+	if err != nil {
+		return nil, err
+	}
+	if current.private == nil {
+		return nil, fmt.Errorf("signing key %q must be a private key", kid)
+	}
+
+	kr := &keyring{
+		current: current,
+		keys:    map[string]*signingKey{kid: current},
+	}
+
+	if strings.TrimSpace(previous) == "" {
+		return kr, nil
+	}
+
+	var entries []previousKey
+	if err := json.Unmarshal([]byte(previous), &entries); err != nil {
+		return nil, fmt.Errorf("JWT_PREVIOUS_KEYS must be a JSON array of {\"kid\", \"alg\", \"key\"} objects: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.Kid == "" || entry.Key == "" {
+			return nil, errors.New("JWT_PREVIOUS_KEYS entries must have a kid and a key")
+		}
+		if _, exists := kr.keys[entry.Kid]; exists {
+			return nil, fmt.Errorf("duplicate key id %q", entry.Kid)
+		}
+		k, err := loadSigningKey(entry.Kid, entry.Alg, entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		kr.keys[k.id] = k
+	}
+
+	return kr, nil
+}
+
+func loadSigningKey(kid, alg, value string) (*signingKey, error) {
+	switch alg {
+	case "", "HS256":
+		secret := []byte(value)
+		return &signingKey{id: kid, method: jwt.SigningMethodHS256, private: secret, public: secret}, nil
+
+	case "RS256":
+		pem, err := os.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+		if pub, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+			return &signingKey{id: kid, method: jwt.SigningMethodRS256, public: pub}, nil
+		}
+		priv, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kid, err)
+		}
+		return &signingKey{id: kid, method: jwt.SigningMethodRS256, private: priv, public: &priv.PublicKey}, nil
+
+	case "EdDSA":
+		pem, err := os.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+		if pub, err := jwt.ParseEdPublicKeyFromPEM(pem); err == nil {
+			return &signingKey{id: kid, method: jwt.SigningMethodEdDSA, public: pub}, nil
+		}
+		priv, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kid, err)
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("key %q: not a signing key", kid)
+		}
+		return &signingKey{id: kid, method: jwt.SigningMethodEdDSA, private: priv, public: signer.Public()}, nil
+
+	default:
+		return nil, fmt.Errorf("key %q: unsupported signing algorithm %q", kid, alg)
+	}
+}
+
+// lookup is the jwt.Keyfunc used when verifying tokens. The kid header picks
+// the key and the token's alg must match the one configured for that key.
+func (kr *keyring) lookup(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, errors.New("missing kid header")
+	}
+	key, ok := kr.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.public, nil
+}
+
+func (kr *keyring) sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(kr.current.method, claims)
+	token.Header["kid"] = kr.current.id
+	return token.SignedString(kr.current.private)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// jwks returns the public half of every asymmetric key. HMAC secrets are never
+// published.
+func (kr *keyring) jwks() []jwk {
+	keys := []jwk{}
+	for _, k := range kr.keys {
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, jwk{
+				Kty: "RSA",
+				Kid: k.id,
+				Alg: k.method.Alg(),
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, jwk{
+				Kty: "OKP",
+				Kid: k.id,
+				Alg: k.method.Alg(),
+				Use: "sig",
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return keys
+}
+
+func (ser Server) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=300")
+
+	err := ser.writeJSON(w, http.StatusOK, envelope{"keys": ser.keys.jwks()}, headers)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
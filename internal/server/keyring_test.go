@@ -0,0 +1,162 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeRSAKey(t *testing.T) (string, *rsa.PrivateKey) {
+	t.Helper()
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+	return path, priv
+}
+
+func previousKeys(t *testing.T, keys ...previousKey) string {
+	t.Helper()
+
+	js, err := json.Marshal(keys)
+	if err != nil {
+		t.Fatalf("marshalling previous keys: %v", err)
+	}
+	return string(js)
+}
+
+func TestKeyringPreviousSecretsKeepDelimiters(t *testing.T) {
+	secret := "old,secret:with:colons,and,commas"
+
+	old, err := newKeyring("HS256", "old", secret, "")
+	if err != nil {
+		t.Fatalf("newKeyring: %v", err)
+	}
+	token, err := old.sign(jwt.MapClaims{"sub": "1"})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	rotated, err := newKeyring("HS256", "new", "new-secret", previousKeys(t, previousKey{Kid: "old", Alg: "HS256", Key: secret}))
+	if err != nil {
+		t.Fatalf("newKeyring: %v", err)
+	}
+	if _, err := jwt.Parse(token, rotated.lookup); err != nil {
+		t.Fatalf("expected token signed with the previous key to verify, got %v", err)
+	}
+
+	fresh, err := rotated.sign(jwt.MapClaims{"sub": "1"})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	parsed, err := jwt.Parse(fresh, rotated.lookup)
+	if err != nil {
+		t.Fatalf("expected token signed with the current key to verify, got %v", err)
+	}
+	if parsed.Header["kid"] != "new" {
+		t.Errorf("expected new tokens to carry kid %q, got %v", "new", parsed.Header["kid"])
+	}
+}
+
+func TestKeyringRejectsBadPreviousKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous string
+	}{
+		{"not JSON", "old:HS256:secret"},
+		{"missing key", `[{"kid": "old", "alg": "HS256"}]`},
+		{"missing kid", `[{"alg": "HS256", "key": "secret"}]`},
+		{"duplicate kid", `[{"kid": "current", "alg": "HS256", "key": "secret"}]`},
+		{"unsupported alg", `[{"kid": "old", "alg": "none", "key": "secret"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newKeyring("HS256", "current", "secret", tt.previous); err == nil {
+				t.Errorf("expected an error for %s", tt.previous)
+			}
+		})
+	}
+}
+
+func TestKeyringLookup(t *testing.T) {
+	path, priv := writeRSAKey(t)
+
+	kr, err := newKeyring("RS256", "rsa", path, previousKeys(t, previousKey{Kid: "hmac", Alg: "HS256", Key: "secret"}))
+	if err != nil {
+		t.Fatalf("newKeyring: %v", err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid interface{}, key interface{}) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "1"})
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("signing: %v", err)
+		}
+		return s
+	}
+
+	// The RSA public key's PEM bytes used as an HMAC secret is the classic
+	// algorithm confusion attack.
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&priv.PublicKey)})
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"current key", sign(jwt.SigningMethodRS256, "rsa", priv), true},
+		{"previous key", sign(jwt.SigningMethodHS256, "hmac", []byte("secret")), true},
+		{"missing kid", sign(jwt.SigningMethodRS256, nil, priv), false},
+		{"unknown kid", sign(jwt.SigningMethodRS256, "other", priv), false},
+		{"non-string kid", sign(jwt.SigningMethodRS256, 1, priv), false},
+		{"alg not pinned to kid", sign(jwt.SigningMethodHS256, "rsa", publicPEM), false},
+		{"wrong secret", sign(jwt.SigningMethodHS256, "hmac", []byte("guess")), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Parse(tt.token, kr.lookup)
+			if tt.valid && err != nil {
+				t.Errorf("expected token to verify, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected token to be rejected")
+			}
+		})
+	}
+}
+
+func TestKeyringJWKSOmitsSecrets(t *testing.T) {
+	path, _ := writeRSAKey(t)
+
+	kr, err := newKeyring("RS256", "rsa", path, previousKeys(t, previousKey{Kid: "hmac", Alg: "HS256", Key: "secret"}))
+	if err != nil {
+		t.Fatalf("newKeyring: %v", err)
+	}
+
+	keys := kr.jwks()
+	if len(keys) != 1 {
+		t.Fatalf("expected only the RSA key to be published, got %d keys", len(keys))
+	}
+	if keys[0].Kid != "rsa" || keys[0].Kty != "RSA" || keys[0].Alg != "RS256" {
+		t.Errorf("unexpected JWK %+v", keys[0])
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+// requestLocale picks the supported locale the client prefers most according
+// to its Accept-Language header, e.g. "am-ET, en;q=0.8" gives "am". Regional
+// variants match their base language. It falls back to the default locale.
+func requestLocale(r *http.Request) string {
+	locale, best := database.DefaultLocale, 0.0
+
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+
+		quality := 1.0
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		if quality > best && validator.In(base, database.SupportedLocales...) {
+			locale, best = base, quality
+		}
+	}
+
+	return locale
+}
+
+// responseLocale is requestLocale for handlers whose response is localized; it
+// tells caches the response varies with Accept-Language.
+func responseLocale(w http.ResponseWriter, r *http.Request) string {
+	w.Header().Add("Vary", "Accept-Language")
+	return requestLocale(r)
+}
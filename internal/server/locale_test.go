@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestLocale(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		locale string
+	}{
+		{"no header", "", "en"},
+		{"supported", "am", "am"},
+		{"regional variant", "am-ET", "am"},
+		{"case insensitive", "AM-et", "am"},
+		{"preference order", "am-ET, en;q=0.8", "am"},
+		{"higher quality wins", "en;q=0.5, am;q=0.9", "am"},
+		{"equal quality keeps the first", "en, am", "en"},
+		{"unsupported falls through", "fr-FR, am;q=0.5", "am"},
+		{"only unsupported", "fr-FR, de;q=0.9", "en"},
+		{"wildcard", "*", "en"},
+		{"zero quality", "am;q=0", "en"},
+		{"malformed quality is skipped", "am;q=high, en;q=0.1", "en"},
+		{"whitespace", "  am ;q=0.7 ,  en ; q=0.3", "am"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Accept-Language", tt.header)
+			}
+			if got := requestLocale(r); got != tt.locale {
+				t.Errorf("expected %q, got %q", tt.locale, got)
+			}
+		})
+	}
+}
+
+func TestResponseLocaleSetsVary(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "am")
+	rr := httptest.NewRecorder()
+
+	if got := responseLocale(rr, r); got != "am" {
+		t.Errorf("expected %q, got %q", "am", got)
+	}
+	if vary := rr.Header().Values("Vary"); len(vary) != 1 || vary[0] != "Accept-Language" {
+		t.Errorf("expected Vary: Accept-Language, got %v", vary)
+	}
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+// currentUser loads the user behind the request's principal, writing the
+// error response itself when that fails.
+func (ser Server) currentUser(w http.ResponseWriter, r *http.Request) (*database.User, bool) {
+	user, err := ser.models.Users.Get(contextGetPrincipal(r).UserId)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+func (ser Server) meGet(w http.ResponseWriter, r *http.Request) {
+	user, ok := ser.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := ser.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+// mePatch only lets users change their own profile fields. Email, role and
+// credentials have dedicated flows.
+func (ser Server) mePatch(w http.ResponseWriter, r *http.Request) {
+	user, ok := ser.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name         *string `json:"name"`
+		Phone_Number *string `json:"phone_number"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+	if input.Phone_Number != nil {
+		user.Phone_Number = *input.Phone_Number
+	}
+
+	v := validator.New()
+	if database.ValidateUser(v, user); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := ser.models.Users.Patch(user); err != nil {
+		switch {
+		case errors.Is(err, database.ErrDuplicatePhoneNumber):
+			v.AddError("phone_number", "a user with this phone number already exists.")
+			ser.failedValidationResponse(w, r, v.Errors)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err := ser.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) mePasswordChange(w http.ResponseWriter, r *http.Request) {
+	user, ok := ser.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Current_Password string `json:"current_password"`
+		New_Password     string `json:"new_password"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	matches, err := user.Password.Matches(input.Current_Password)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(matches, "current_password", "current password is incorrect")
+	database.ValidatePasswordPlaintext(v, "new_password", input.New_Password)
+	if !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err = user.Password.Set(input.New_Password); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = ser.models.Users.Patch(user); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// A changed password ends every existing session, including ones an
+	// attacker may hold with the old password.
+	if err = ser.models.Sessions.RevokeAllForUser(user.Id); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"message": "password successfully changed, please log in again"}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+// meEmailChange starts an email change. The address only switches once the
+// token mailed to the new address is confirmed through emailChangeConfirm.
+func (ser Server) meEmailChange(w http.ResponseWriter, r *http.Request) {
+	user, ok := ser.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Email            string `json:"email"`
+		Current_Password string `json:"current_password"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	matches, err := user.Password.Matches(input.Current_Password)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(matches, "current_password", "current password is incorrect")
+	v.Check(input.Email != "", "email", "email must not be empty")
+	v.Check(validator.Matches(input.Email, validator.EmailRX), "email", "not a valid email")
+	if v.Valid() {
+		_, err = ser.models.Users.GetByEmail(input.Email)
+		switch {
+		case err == nil:
+			v.AddError("email", "a user with this email already exists.")
+		case !errors.Is(err, database.ErrRecordNotFound):
+			ser.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err = ser.models.Tokens.DeleteAllForUser(database.ScopeEmailChange, user.Id); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = ser.models.Users.SetPendingEmail(user.Id, input.Email); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := ser.models.Tokens.New(user.Id, 24*time.Hour, database.ScopeEmailChange)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	go func() {
+		data := map[string]interface{}{
+			"frontendURL": ser.frontendURL,
+			"token":       token.Plaintext,
+		}
+
+		err := ser.mailer.Send(input.Email, "email_change.tmpl", data)
+		if err != nil {
+			ser.logger.PrintError(err, nil)
+		}
+	}()
+
+	err = ser.writeJSON(w, http.StatusAccepted, envelope{"message": "a confirmation email has been sent to the new address"}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) emailChangeConfirm(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		PlainText string `json:"plain_text"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if database.ValidateTokenPlaintext(v, input.PlainText); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	hash := sha256.Sum256([]byte(input.PlainText))
+	user, err := ser.models.Users.GetToken(hash, database.ScopeEmailChange, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			ser.failedValidationResponse(w, r, v.Errors)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	email, err := ser.models.Users.ConfirmEmailChange(user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			ser.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, database.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email already exists.")
+			ser.failedValidationResponse(w, r, v.Errors)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err = ser.models.Tokens.DeleteAllForUser(database.ScopeEmailChange, user.Id); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"email": email}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+	"github.com/Mahider-T/autoSphere/internal/totp"
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+const totpIssuer = "AutoSphere"
+
+func (ser Server) totpEnroll(w http.ResponseWriter, r *http.Request) {
+	user, err := ser.models.Users.Get(contextGetPrincipal(r).UserId)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err = ser.models.MFA.SetPendingTOTP(user.Id, secret); err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.conflictResponse(w, r, "two-factor authentication is already enabled")
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{
+		"secret":           totp.EncodeSecret(secret),
+		"provisioning_uri": totp.URI(totpIssuer, user.Email, secret),
+	}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) totpConfirm(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	userId := contextGetPrincipal(r).UserId
+	otp, err := ser.models.MFA.GetTOTP(userId)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if otp.Enabled {
+		ser.conflictResponse(w, r, "two-factor authentication is already enabled")
+		return
+	}
+
+	v := validator.New()
+	v.Check(otp.Secret != nil, "code", "start enrollment before confirming it")
+	if v.Valid() {
+		step, ok := totp.Validate(otp.Secret, input.Code, time.Now(), otp.LastStep)
+		v.Check(ok, "code", "invalid one-time code")
+		if ok {
+			otp.LastStep = step
+		}
+	}
+	if !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	codes, err := ser.models.MFA.EnableTOTP(userId, otp.LastStep)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			// Enabled concurrently by another request.
+			ser.conflictResponse(w, r, "two-factor authentication is already enabled")
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"mfa_enabled": true, "recovery_codes": codes}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+// loginMFA is the second login step. It exchanges the challenge token from
+// login plus a TOTP or recovery code for the access/refresh pair.
+func (ser Server) loginMFA(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MFA_Token     string `json:"mfa_token"`
+		Code          string `json:"code"`
+		Recovery_Code string `json:"recovery_code"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	claims, err := ser.verifyToken(input.MFA_Token, tokenTypeMFAChallenge)
+	if err != nil {
+		ser.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+	userId, ok := claims["sub"].(float64)
+	if !ok {
+		ser.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	user, err := ser.models.Users.Get(int64(userId))
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.invalidAuthenticationTokenResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	otp, err := ser.models.MFA.GetTOTP(user.Id)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+	if !otp.Enabled {
+		ser.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	if !ser.verifySecondFactor(w, r, user, otp, input.Code, input.Recovery_Code) {
+		return
+	}
+
+	ser.issueTokens(w, r, *user, true)
+}
+
+// mfaRecoveryCodesRegenerate replaces the caller's recovery codes, for when
+// they have run out or may have leaked. The caller confirms with a current
+// TOTP or recovery code.
+func (ser Server) mfaRecoveryCodesRegenerate(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code          string `json:"code"`
+		Recovery_Code string `json:"recovery_code"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, otp, ok := ser.enabledTOTP(w, r)
+	if !ok {
+		return
+	}
+
+	if !ser.verifySecondFactor(w, r, user, otp, input.Code, input.Recovery_Code) {
+		return
+	}
+
+	codes, err := ser.models.MFA.NewRecoveryCodes(user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			// Disabled concurrently by another request.
+			ser.conflictResponse(w, r, "two-factor authentication is not enabled")
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+// totpDisable turns TOTP off for the caller and drops their recovery codes.
+// The caller confirms with a current TOTP or recovery code. Users whose role
+// requires MFA can't turn it off.
+func (ser Server) totpDisable(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code          string `json:"code"`
+		Recovery_Code string `json:"recovery_code"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.badRequestResponse(w, r, err)
+		return
+	}
+
+	p := contextGetPrincipal(r)
+	required, err := ser.mfaRequired(p.RoleId, p.Role)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+	if required {
+		ser.errorResponse(w, r, http.StatusForbidden, "your role requires two-factor authentication")
+		return
+	}
+
+	user, otp, ok := ser.enabledTOTP(w, r)
+	if !ok {
+		return
+	}
+
+	if !ser.verifySecondFactor(w, r, user, otp, input.Code, input.Recovery_Code) {
+		return
+	}
+
+	if err = ser.models.MFA.DisableTOTP(user.Id); err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.conflictResponse(w, r, "two-factor authentication is not enabled")
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"mfa_enabled": false}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+// enabledTOTP loads the caller and their TOTP settings, responding with a
+// conflict if TOTP isn't enabled.
+func (ser Server) enabledTOTP(w http.ResponseWriter, r *http.Request) (*database.User, *database.TOTP, bool) {
+	user, err := ser.models.Users.Get(contextGetPrincipal(r).UserId)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	otp, err := ser.models.MFA.GetTOTP(user.Id)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return nil, nil, false
+	}
+	if !otp.Enabled {
+		ser.conflictResponse(w, r, "two-factor authentication is not enabled")
+		return nil, nil, false
+	}
+	return user, otp, true
+}
+
+// verifySecondFactor checks a TOTP or recovery code for a user with TOTP
+// enabled. Failures count toward the same lockout as failed logins. It writes
+// the error response and returns false unless the code was accepted.
+func (ser Server) verifySecondFactor(w http.ResponseWriter, r *http.Request, user *database.User, otp *database.TOTP, code, recoveryCode string) bool {
+	accountKey := database.AccountAttemptKey(user.Email)
+	ipKey := database.IPAttemptKey(clientIP(r))
+
+	lockedUntil, err := ser.models.LoginAttempts.LockedUntil(accountKey, ipKey)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return false
+	}
+	if !lockedUntil.IsZero() {
+		ser.tooManyLoginAttemptsResponse(w, r, time.Until(lockedUntil))
+		return false
+	}
+
+	verified := false
+	switch {
+	case code != "":
+		if step, ok := totp.Validate(otp.Secret, code, time.Now(), otp.LastStep); ok {
+			verified, err = ser.models.MFA.UseTOTPStep(user.Id, step)
+		}
+	case recoveryCode != "":
+		err = ser.models.MFA.UseRecoveryCode(user.Id, recoveryCode)
+		verified = err == nil
+		if errors.Is(err, database.ErrRecordNotFound) {
+			err = nil
+		}
+	}
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !verified {
+		if err = ser.recordLoginFailure(accountKey, ipKey); err != nil {
+			ser.serverErrorResponse(w, r, err)
+			return false
+		}
+		ser.invalidOneTimeCodeResponse(w, r)
+		return false
+	}
+
+	if err = ser.models.LoginAttempts.Reset(accountKey); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+// How long a reviewer keeps a shop after claiming it. Claiming again before it
+// runs out extends the claim.
+const moderationClaimTTL = 15 * time.Minute
+
+func (ser Server) moderationQueue(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Unclaimed bool
+		Filters   database.Filters
+	}
+
+	v := validator.New()
+
+	input.Unclaimed = ser.parseBool(r, "unclaimed", false, v)
+	input.Filters.Page = ser.parseInt(r, "page", 1, v)
+	input.Filters.PageSize = ser.parseInt(r, "page_size", 20, v)
+	input.Filters.Sort = "submitted_at"
+	input.Filters.SortSafelist = []string{"submitted_at"}
+
+	if database.ValidateFilters(v, input.Filters); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	shops, metadata, err := ser.models.Moderation.Queue(input.Unclaimed, responseLocale(w, r), input.Filters)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "shops": shops}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) moderationClaim(w http.ResponseWriter, r *http.Request) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	claim, err := ser.models.Moderation.Claim(id, contextGetPrincipal(r).UserId, moderationClaimTTL)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		case errors.Is(err, database.ErrShopNotPending):
+			ser.conflictResponse(w, r, "only pending shops can be claimed")
+		case errors.Is(err, database.ErrShopClaimed):
+			ser.conflictResponse(w, r, "the shop is claimed by another reviewer")
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"claim": claim}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) moderationRelease(w http.ResponseWriter, r *http.Request) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	if err = ser.models.Moderation.Release(id, contextGetPrincipal(r).UserId); err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"message": "claim successfully released"}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+// moderationDecide approves or declines a shop the caller has claimed. The
+// transition releases the claim.
+func (ser Server) moderationDecide(w http.ResponseWriter, r *http.Request) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Approval_Status database.ShopApprovalStatus `json:"approval_status"`
+		Reason          string                      `json:"reason"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	actorId := contextGetPrincipal(r).UserId
+	event := &database.ShopApprovalEvent{
+		ShopId:  id,
+		ActorId: &actorId,
+		To:      input.Approval_Status,
+		Reason:  input.Reason,
+	}
+
+	v := validator.New()
+	v.Check(event.To != database.PENDING, "approval_status", "must be APPROVED or DECLINED")
+	if database.ValidateApprovalEvent(v, event); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	holds, err := ser.models.Moderation.HoldsClaim(id, actorId)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+	if !holds {
+		ser.conflictResponse(w, r, "claim the shop before deciding on it")
+		return
+	}
+
+	if !ser.transitionShop(w, r, event) {
+		return
+	}
+
+	ser.notifyShopReview(event)
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"id": id, "approval_status": event.To, "event": event}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) moderationStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := ser.models.Moderation.Stats()
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
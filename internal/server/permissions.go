@@ -0,0 +1,133 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+)
+
+// permissionCache keeps the role -> permission mapping in memory so access
+// checks don't hit the database on every request. Roles are keyed by id, so
+// renaming a role doesn't strip its permissions from tokens issued under the
+// old name. It reloads after ttl, and immediately once invalidated by the
+// role endpoints; other instances pick up role changes within ttl.
+type permissionCache struct {
+	mu       sync.RWMutex
+	ttl      time.Duration
+	loadedAt time.Time
+	byRole   map[int64]database.RoleGrants
+	ids      map[database.Role]int64
+	load     func() (map[int64]database.RoleGrants, error)
+}
+
+func newPermissionCache(ttl time.Duration, load func() (map[int64]database.RoleGrants, error)) *permissionCache {
+	return &permissionCache{ttl: ttl, load: load}
+}
+
+// snapshot returns the cached mapping, reloading it first if it is stale.
+func (c *permissionCache) snapshot() (map[int64]database.RoleGrants, map[database.Role]int64, error) {
+	c.mu.RLock()
+	byRole, ids := c.byRole, c.ids
+	fresh := byRole != nil && time.Since(c.loadedAt) < c.ttl
+	c.mu.RUnlock()
+
+	if fresh {
+		return byRole, ids, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.byRole == nil || time.Since(c.loadedAt) >= c.ttl {
+		byRole, err := c.load()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ids := make(map[database.Role]int64, len(byRole))
+		for id, grants := range byRole {
+			ids[grants.Name] = id
+		}
+
+		c.byRole, c.ids = byRole, ids
+		c.loadedAt = time.Now()
+	}
+	return c.byRole, c.ids, nil
+}
+
+func (c *permissionCache) has(roleId int64, permission string) (bool, error) {
+	byRole, _, err := c.snapshot()
+	if err != nil {
+		return false, err
+	}
+	return byRole[roleId].Permissions[permission], nil
+}
+
+// mfaRequired reports whether users of the role must log in with a second
+// factor.
+func (c *permissionCache) mfaRequired(roleId int64) (bool, error) {
+	byRole, _, err := c.snapshot()
+	if err != nil {
+		return false, err
+	}
+	return byRole[roleId].MFARequired, nil
+}
+
+// roleId resolves a role's current name to its id. It returns 0 for a name
+// no role has, which grants nothing.
+func (c *permissionCache) roleId(role database.Role) (int64, error) {
+	_, ids, err := c.snapshot()
+	if err != nil {
+		return 0, err
+	}
+	return ids[role], nil
+}
+
+func (c *permissionCache) invalidate() {
+	c.mu.Lock()
+	c.byRole = nil
+	c.ids = nil
+	c.mu.Unlock()
+}
+
+// can reports whether the caller's role grants permission. Anonymous callers
+// have no permissions.
+func (ser *Server) can(r *http.Request, permission string) (bool, error) {
+	p := contextGetPrincipal(r)
+	if p.IsAnonymous() {
+		return false, nil
+	}
+
+	roleId, err := ser.resolveRoleId(p.RoleId, p.Role)
+	if err != nil {
+		return false, err
+	}
+	return ser.permissions.has(roleId, permission)
+}
+
+// mfaRequired reports whether users of the role must log in with a second
+// factor, either because the role is marked so or because MFA_REQUIRED_ROLES
+// names it.
+func (ser *Server) mfaRequired(roleId int64, role database.Role) (bool, error) {
+	if roleInList(role, ser.mfaRoles) {
+		return true, nil
+	}
+
+	roleId, err := ser.resolveRoleId(roleId, role)
+	if err != nil {
+		return false, err
+	}
+	return ser.permissions.mfaRequired(roleId)
+}
+
+// resolveRoleId returns roleId, or the id of the role currently named role
+// when roleId is unknown. Tokens issued before role ids were added to them
+// only carry the name.
+func (ser *Server) resolveRoleId(roleId int64, role database.Role) (int64, error) {
+	if roleId != 0 {
+		return roleId, nil
+	}
+	return ser.permissions.roleId(role)
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+)
+
+// fakeRoles stands in for RoleModel.PermissionsByRole and counts loads.
+type fakeRoles struct {
+	grants map[int64]database.RoleGrants
+	err    error
+	loads  int
+}
+
+func (f *fakeRoles) load() (map[int64]database.RoleGrants, error) {
+	f.loads++
+	if f.err != nil {
+		return nil, f.err
+	}
+	copied := make(map[int64]database.RoleGrants, len(f.grants))
+	for id, grants := range f.grants {
+		copied[id] = grants
+	}
+	return copied, nil
+}
+
+func newFakeRoles() *fakeRoles {
+	return &fakeRoles{grants: map[int64]database.RoleGrants{
+		1: {Name: "ADMIN", MFARequired: true, Permissions: map[string]bool{"roles:manage": true, "shops:write": true}},
+		2: {Name: "MECHANIC", Permissions: map[string]bool{"shops:write": true}},
+		3: {Name: "GUEST", Permissions: map[string]bool{}},
+	}}
+}
+
+func TestPermissionCacheHas(t *testing.T) {
+	c := newPermissionCache(time.Minute, newFakeRoles().load)
+
+	tests := []struct {
+		name       string
+		roleId     int64
+		permission string
+		want       bool
+	}{
+		{"granted", 2, "shops:write", true},
+		{"not granted", 2, "roles:manage", false},
+		{"role without permissions", 3, "shops:write", false},
+		{"unknown role", 99, "shops:write", false},
+		{"no role", 0, "shops:write", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.has(tt.roleId, tt.permission)
+			if err != nil {
+				t.Fatalf("has: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPermissionCacheReloads(t *testing.T) {
+	roles := newFakeRoles()
+	c := newPermissionCache(time.Minute, roles.load)
+
+	c.has(2, "shops:write")
+	c.has(2, "shops:write")
+	if roles.loads != 1 {
+		t.Fatalf("expected a fresh cache to load once, loaded %d times", roles.loads)
+	}
+
+	roles.grants[2] = database.RoleGrants{Name: "MECHANIC", Permissions: map[string]bool{}}
+	c.invalidate()
+
+	if granted, _ := c.has(2, "shops:write"); granted {
+		t.Error("expected a revoked permission to be denied after invalidation")
+	}
+	if roles.loads != 2 {
+		t.Errorf("expected invalidation to force a reload, loaded %d times", roles.loads)
+	}
+
+	expiring := newPermissionCache(time.Nanosecond, roles.load)
+	expiring.has(2, "shops:write")
+	time.Sleep(time.Millisecond)
+	expiring.has(2, "shops:write")
+	if roles.loads != 4 {
+		t.Errorf("expected a stale cache to reload, loaded %d times", roles.loads)
+	}
+}
+
+func TestPermissionCacheLoadError(t *testing.T) {
+	roles := &fakeRoles{err: errors.New("database down")}
+	c := newPermissionCache(time.Minute, roles.load)
+
+	if _, err := c.has(1, "shops:write"); err == nil {
+		t.Error("expected the load error to be returned")
+	}
+	if _, err := c.roleId("ADMIN"); err == nil {
+		t.Error("expected the load error to be returned")
+	}
+}
+
+// A token carries both the role name and id; after a rename only the id
+// still matches, and it must keep the role's permissions.
+func TestCanAfterRoleRename(t *testing.T) {
+	roles := newFakeRoles()
+	ser := &Server{permissions: newPermissionCache(time.Minute, roles.load)}
+
+	roleId, err := ser.permissions.roleId("MECHANIC")
+	if err != nil || roleId != 2 {
+		t.Fatalf("expected MECHANIC to resolve to 2, got %d, %v", roleId, err)
+	}
+
+	roles.grants[2] = database.RoleGrants{Name: "TECHNICIAN", Permissions: roles.grants[2].Permissions}
+	ser.permissions.invalidate()
+
+	tests := []struct {
+		name string
+		p    *principal
+		want bool
+	}{
+		{"token issued before the rename", &principal{UserId: 1, Role: "MECHANIC", RoleId: 2}, true},
+		{"token issued after the rename", &principal{UserId: 1, Role: "TECHNICIAN", RoleId: 2}, true},
+		{"token without a role id", &principal{UserId: 1, Role: "TECHNICIAN"}, true},
+		{"token without a role id under the old name", &principal{UserId: 1, Role: "MECHANIC"}, false},
+		{"anonymous", anonymousPrincipal, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := contextSetPrincipal(httptest.NewRequest("GET", "/", nil), tt.p)
+			got, err := ser.can(r, "shops:write")
+			if err != nil {
+				t.Fatalf("can: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+// MFA is a property of the role, so renaming it doesn't drop the requirement.
+// MFA_REQUIRED_ROLES can add roles by name on top.
+func TestMFARequired(t *testing.T) {
+	roles := newFakeRoles()
+	ser := &Server{
+		permissions: newPermissionCache(time.Minute, roles.load),
+		mfaRoles:    parseRoles("MECHANIC"),
+	}
+
+	roles.grants[1] = database.RoleGrants{Name: "SUPERUSER", MFARequired: true, Permissions: roles.grants[1].Permissions}
+
+	tests := []struct {
+		name   string
+		roleId int64
+		role   database.Role
+		want   bool
+	}{
+		{"renamed role marked mfa_required", 1, "ADMIN", true},
+		{"renamed role looked up by its new name", 0, "SUPERUSER", true},
+		{"role named by MFA_REQUIRED_ROLES", 2, "MECHANIC", true},
+		{"role without the requirement", 3, "GUEST", false},
+		{"unknown role", 0, "NOBODY", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ser.mfaRequired(tt.roleId, tt.role)
+			if err != nil {
+				t.Fatalf("mfaRequired: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseRoles(t *testing.T) {
+	tests := []struct {
+		csv  string
+		want []database.Role
+	}{
+		{"", []database.Role{}},
+		{" , ", []database.Role{}},
+		{"ADMIN", []database.Role{"ADMIN"}},
+		{"ADMIN, OPERATOR,", []database.Role{"ADMIN", "OPERATOR"}},
+	}
+
+	for _, tt := range tests {
+		got := parseRoles(tt.csv)
+		if len(got) != len(tt.want) {
+			t.Errorf("parseRoles(%q): expected %v, got %v", tt.csv, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("parseRoles(%q): expected %v, got %v", tt.csv, tt.want, got)
+				break
+			}
+		}
+	}
+}
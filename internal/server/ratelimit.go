@@ -0,0 +1,39 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows one event per key per window. It is kept in memory, so
+// limits are per instance.
+type rateLimiter struct {
+	mu     sync.Mutex
+	window time.Duration
+	last   map[string]time.Time
+}
+
+func newRateLimiter(window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		window: window,
+		last:   make(map[string]time.Time),
+	}
+}
+
+func (l *rateLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for k, t := range l.last {
+		if now.Sub(t) >= l.window {
+			delete(l.last, k)
+		}
+	}
+
+	if _, limited := l.last[key]; limited {
+		return false
+	}
+	l.last[key] = now
+	return true
+}
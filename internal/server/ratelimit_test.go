@@ -0,0 +1,67 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllowsOncePerWindow(t *testing.T) {
+	l := newRateLimiter(50 * time.Millisecond)
+
+	if !l.allow("a@example.com") {
+		t.Fatal("expected the first event to be allowed")
+	}
+	if l.allow("a@example.com") {
+		t.Fatal("expected a second event within the window to be limited")
+	}
+	if !l.allow("b@example.com") {
+		t.Fatal("expected other keys to be limited separately")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if !l.allow("a@example.com") {
+		t.Fatal("expected an event after the window to be allowed")
+	}
+}
+
+func TestRateLimiterForgetsExpiredKeys(t *testing.T) {
+	l := newRateLimiter(10 * time.Millisecond)
+
+	for _, key := range []string{"a", "b", "c"} {
+		l.allow(key)
+	}
+	time.Sleep(20 * time.Millisecond)
+	l.allow("d")
+
+	if len(l.last) != 1 {
+		t.Errorf("expected expired keys to be dropped, %d keys remain", len(l.last))
+	}
+}
+
+func TestRateLimiterConcurrentCallers(t *testing.T) {
+	l := newRateLimiter(time.Minute)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if l.allow("same") {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 1 {
+		t.Errorf("expected exactly one concurrent event to be allowed, got %d", allowed)
+	}
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+func (ser Server) roleGetAll(w http.ResponseWriter, r *http.Request) {
+	roles, err := ser.models.Roles.GetAll()
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) roleGetOne(w http.ResponseWriter, r *http.Request) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	role, err := ser.models.Roles.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"role": role}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) roleCreate(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		MFARequired bool     `json:"mfa_required"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	role := &database.RoleDefinition{
+		Name:        database.Role(input.Name),
+		Description: input.Description,
+		MFARequired: input.MFARequired,
+		Permissions: input.Permissions,
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+
+	v := validator.New()
+	if database.ValidateRole(v, role); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := ser.models.Roles.Create(role); err != nil {
+		ser.roleSaveError(w, r, v, err)
+		return
+	}
+	ser.permissions.invalidate()
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/roles/%d", role.Id))
+
+	err := ser.writeJSON(w, http.StatusCreated, envelope{"role": role}, headers)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) rolePatch(w http.ResponseWriter, r *http.Request) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	role, err := ser.models.Roles.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// ADMIN holds roles:manage; letting it be edited could lock everyone out
+	// of role management.
+	if role.Name == database.ADMIN {
+		ser.errorResponse(w, r, http.StatusForbidden, "the ADMIN role can't be changed")
+		return
+	}
+
+	var input struct {
+		Name        *string   `json:"name"`
+		Description *string   `json:"description"`
+		MFARequired *bool     `json:"mfa_required"`
+		Permissions *[]string `json:"permissions"`
+	}
+
+	if err = ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		role.Name = database.Role(*input.Name)
+	}
+	if input.Description != nil {
+		role.Description = *input.Description
+	}
+	if input.MFARequired != nil {
+		role.MFARequired = *input.MFARequired
+	}
+	if input.Permissions != nil {
+		role.Permissions = *input.Permissions
+	}
+
+	v := validator.New()
+	if database.ValidateRole(v, role); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err = ser.models.Roles.Update(role); err != nil {
+		ser.roleSaveError(w, r, v, err)
+		return
+	}
+	ser.permissions.invalidate()
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"role": role}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) roleSaveError(w http.ResponseWriter, r *http.Request, v *validator.Validator, err error) {
+	switch {
+	case errors.Is(err, database.ErrRecordNotFound):
+		ser.notFoundResponse(w, r)
+	case errors.Is(err, database.ErrDuplicateRole):
+		v.AddError("name", "a role with this name already exists")
+		ser.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, database.ErrUnknownPermission):
+		v.AddError("permissions", "permissions must only contain known permission codes")
+		ser.failedValidationResponse(w, r, v.Errors)
+	default:
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) roleDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	role, err := ser.models.Roles.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if role.Name == database.ADMIN {
+		ser.errorResponse(w, r, http.StatusForbidden, "the ADMIN role can't be deleted")
+		return
+	}
+
+	if err = ser.models.Roles.Delete(id); err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		case errors.Is(err, database.ErrRoleInUse):
+			ser.conflictResponse(w, r, "the role is still assigned to users")
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	ser.permissions.invalidate()
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"message": "role successfully deleted"}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) permissionGetAll(w http.ResponseWriter, r *http.Request) {
+	permissions, err := ser.models.Roles.GetAllPermissions()
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
@@ -2,59 +2,186 @@ package server
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+	"github.com/Mahider-T/autoSphere/validator"
 )
 
 type UserContextKey string
 
-const (
-	UserIDKey   UserContextKey = "userID"
-	UserRoleKey UserContextKey = "userRole"
-)
+const PrincipalKey UserContextKey = "principal"
+
+// principal is the caller attached to every request by authenticate. Requests
+// without an Authorization header carry anonymousPrincipal. Callers using an
+// API key act as the key's owner but are limited to the key's scopes.
+type principal struct {
+	UserId   int64
+	Role     database.Role
+	RoleId   int64
+	MFA      bool
+	APIKeyId int64
+	Scopes   []string
+}
+
+var anonymousPrincipal = &principal{}
+
+func (p *principal) IsAnonymous() bool {
+	return p == anonymousPrincipal
+}
+
+func (p *principal) IsAPIKey() bool {
+	return p.APIKeyId != 0
+}
+
+func contextSetPrincipal(r *http.Request, p *principal) *http.Request {
+	ctx := context.WithValue(r.Context(), PrincipalKey, p)
+	return r.WithContext(ctx)
+}
+
+func contextGetPrincipal(r *http.Request) *principal {
+	p, ok := r.Context().Value(PrincipalKey).(*principal)
+	if !ok {
+		return anonymousPrincipal
+	}
+	return p
+}
+
+// authenticate resolves the bearer token or API key (if any) into a principal
+// and stores it in the request context. It never rejects anonymous requests;
+// that is left to authorize so public routes keep working without a token.
+func (ser *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
 
-func (ser Server) RoleMiddleware(handler http.HandlerFunc, requiredRoles ...string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
+			next.ServeHTTP(w, contextSetPrincipal(r, anonymousPrincipal))
 			return
 		}
 
-		tokenString := strings.Split(authHeader, " ")[1]
-		if tokenString == "" {
-			http.Error(w, "Token is missing", http.StatusUnauthorized)
+		headerParts := strings.Split(authHeader, " ")
+		if len(headerParts) != 2 || headerParts[1] == "" {
+			ser.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
-		claims, err := ser.verifyToken(tokenString)
-		if err != nil {
-			ser.unauthorized(w, r)
+		switch headerParts[0] {
+		case "Bearer":
+		case "ApiKey":
+			ser.authenticateAPIKey(w, r, next, headerParts[1])
+			return
+		default:
+			ser.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
-		userRole := claims["role"].(string)
-		if !roleInList(userRole, requiredRoles) {
-			http.Error(w, "Forbidden: You do not have the required role", http.StatusForbidden)
+		claims, err := ser.verifyToken(headerParts[1], tokenTypeAccess)
+		if err != nil {
+			ser.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
-		userID, ok := claims["sub"]
+		userId, ok := claims["sub"].(float64)
+		if !ok {
+			ser.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+		role, ok := claims["role"].(string)
 		if !ok {
-			http.Error(w, "Invalid token: user ID not found", http.StatusUnauthorized)
+			ser.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		mfa, _ := claims["mfa"].(bool)
+		roleId, _ := claims["rid"].(float64)
+
+		p := &principal{
+			UserId: int64(userId),
+			Role:   database.Role(role),
+			RoleId: int64(roleId),
+			MFA:    mfa,
+		}
+		next.ServeHTTP(w, contextSetPrincipal(r, p))
+	})
+}
+
+func (ser *Server) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, plaintext string) {
+	key, err := ser.models.APIKeys.GetForAuthentication(plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.invalidAuthenticationTokenResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	p := &principal{
+		UserId:   key.UserId,
+		Role:     key.Role,
+		RoleId:   key.RoleId,
+		APIKeyId: key.Id,
+		Scopes:   key.Scopes,
+	}
+	next.ServeHTTP(w, contextSetPrincipal(r, p))
+}
+
+// authorize enforces a route's access rules. Authenticated routes turn away
+// anonymous callers and, when they name a permission, callers whose role
+// doesn't grant it. Principals whose role must use MFA are turned away unless
+// they logged in with a second factor or the route is part of enrolling one,
+// and API keys are only accepted on routes that declare a scope the key was
+// granted.
+func (ser *Server) authorize(handler http.HandlerFunc, a access) http.HandlerFunc {
+	if !a.authenticated {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := contextGetPrincipal(r)
+		if p.IsAnonymous() {
+			ser.authenticationRequiredResponse(w, r)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), UserIDKey, userID)
-		ctx = context.WithValue(ctx, UserRoleKey, userRole)
-		r = r.WithContext(ctx)
+		if a.permission != "" {
+			granted, err := ser.can(r, a.permission)
+			if err != nil {
+				ser.serverErrorResponse(w, r, err)
+				return
+			}
+			if !granted {
+				ser.forbiddenErrorResponse(w, r)
+				return
+			}
+		}
+
+		if p.IsAPIKey() {
+			if a.scope == "" || !validator.In(a.scope, p.Scopes...) {
+				ser.forbiddenErrorResponse(w, r)
+				return
+			}
+		} else if !a.allowWithoutMFA && !p.MFA {
+			required, err := ser.mfaRequired(p.RoleId, p.Role)
+			if err != nil {
+				ser.serverErrorResponse(w, r, err)
+				return
+			}
+			if required {
+				ser.mfaRequiredResponse(w, r)
+				return
+			}
+		}
 
 		handler(w, r)
 	}
 }
 
 // roleInList checks if the role exists in the list of required roles
-func roleInList(role string, roles []string) bool {
+func roleInList(role database.Role, roles []database.Role) bool {
 	for _, r := range roles {
 		if r == role {
 			return true
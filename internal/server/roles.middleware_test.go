@@ -0,0 +1,138 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+)
+
+const (
+	routeTestAllowed int64 = 1 // grants every permission
+	routeTestNone    int64 = 2 // grants nothing
+)
+
+// newRouteTestServer returns a Server whose permission cache knows one role
+// granting every permission the routes use and one granting none. It has no
+// models, so any request that gets past authorize to a real handler would
+// panic; tests only ever reach stub handlers.
+func newRouteTestServer() *Server {
+	ser := &Server{}
+
+	all := map[string]bool{}
+	for _, rt := range ser.routes() {
+		if rt.access.permission != "" {
+			all[rt.access.permission] = true
+		}
+	}
+	grants := map[int64]database.RoleGrants{
+		routeTestAllowed: {Name: "ADMIN", MFARequired: true, Permissions: all},
+		routeTestNone:    {Name: "GUEST", Permissions: map[string]bool{}},
+	}
+	ser.permissions = newPermissionCache(time.Minute, func() (map[int64]database.RoleGrants, error) {
+		return grants, nil
+	})
+	return ser
+}
+
+var routeWildcards = regexp.MustCompile(`\{[^}]+\}`)
+
+// routePath splits a mux pattern into its method and a concrete path with
+// every wildcard filled in.
+func routePath(pattern string) (string, string) {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = http.MethodGet, pattern
+	}
+	return method, routeWildcards.ReplaceAllString(path, "1")
+}
+
+// Anonymous callers must be turned away from every non-public route before
+// its handler runs.
+func TestRoutesRejectAnonymous(t *testing.T) {
+	ser := newRouteTestServer()
+	handler := ser.RegisterRoutes()
+
+	for _, rt := range ser.routes() {
+		if !rt.access.authenticated {
+			continue
+		}
+		t.Run(rt.pattern, func(t *testing.T) {
+			method, path := routePath(rt.pattern)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		})
+	}
+}
+
+type routeAccessCase struct {
+	name   string
+	p      *principal
+	status int
+}
+
+// routeAccessCases lists who must be let through a route and who must not.
+func routeAccessCases(a access) []routeAccessCase {
+	user := func(roleId int64, role database.Role, mfa bool) *principal {
+		return &principal{UserId: 1, Role: role, RoleId: roleId, MFA: mfa}
+	}
+	apiKey := func(roleId int64, scopes ...string) *principal {
+		return &principal{UserId: 1, Role: "ADMIN", RoleId: roleId, APIKeyId: 1, Scopes: scopes}
+	}
+
+	withoutMFA := http.StatusForbidden
+	if a.allowWithoutMFA {
+		withoutMFA = http.StatusOK
+	}
+
+	cases := []routeAccessCase{
+		{"user with the permission", user(routeTestAllowed, "ADMIN", true), http.StatusOK},
+		{"MFA role without a second factor", user(routeTestAllowed, "ADMIN", false), withoutMFA},
+		{"API key without a scope", apiKey(routeTestAllowed), http.StatusForbidden},
+		{"API key with another scope", apiKey(routeTestAllowed, "unrelated:scope"), http.StatusForbidden},
+	}
+	if a.permission != "" {
+		cases = append(cases, routeAccessCase{"user without the permission", user(routeTestNone, "GUEST", true), http.StatusForbidden})
+	}
+	if a.scope != "" {
+		cases = append(cases, routeAccessCase{"API key with the scope", apiKey(routeTestAllowed, a.scope), http.StatusOK})
+		if a.permission != "" {
+			cases = append(cases, routeAccessCase{"API key whose role lacks the permission", apiKey(routeTestNone, a.scope), http.StatusForbidden})
+		}
+	}
+	return cases
+}
+
+// Every authenticated route must reject callers whose role, second factor or
+// API key scope doesn't fit, and only those.
+func TestRoutesAccess(t *testing.T) {
+	ser := newRouteTestServer()
+	reached := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	for _, rt := range ser.routes() {
+		if !rt.access.authenticated {
+			continue
+		}
+		for _, tt := range routeAccessCases(rt.access) {
+			t.Run(rt.pattern+"/"+tt.name, func(t *testing.T) {
+				method, path := routePath(rt.pattern)
+				rr := httptest.NewRecorder()
+				r := contextSetPrincipal(httptest.NewRequest(method, path, nil), tt.p)
+
+				ser.authorize(reached, rt.access)(rr, r)
+
+				if rr.Code != tt.status {
+					t.Errorf("expected status %d, got %d: %s", tt.status, rr.Code, rr.Body)
+				}
+			})
+		}
+	}
+}
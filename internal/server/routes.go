@@ -4,57 +4,152 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
 )
 
+// route declares a handler together with who may call it.
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+	access  access
+}
+
+// access describes who may call a route. Public routes need nothing; others
+// need an authenticated caller and, if permission is set, a role granting
+// it. allowWithoutMFA exempts the route from the MFA-mandatory roles check so
+// those users can enroll in the first place. scope is the API key scope that
+// opens the route to machine clients; routes without one are closed to API
+// keys.
+type access struct {
+	authenticated   bool
+	permission      string
+	allowWithoutMFA bool
+	scope           string
+}
+
+var (
+	public        = access{}
+	authenticated = access{authenticated: true}
+)
+
+func requires(permission string) access {
+	return access{authenticated: true, permission: permission}
+}
+
+func (a access) withoutMFA() access {
+	a.allowWithoutMFA = true
+	return a
+}
+
+func (a access) withScope(scope string) access {
+	a.scope = scope
+	return a
+}
+
+func (s *Server) routes() []route {
+	return []route{
+		{"POST /file/upload", s.uploadFile, requires(database.PermissionFilesWrite)},
+		{"GET /file/fetch", s.fetchFile, requires(database.PermissionFilesWrite)},
+		{"DELETE /file", s.deleteFile, requires(database.PermissionFilesWrite)},
+		{"GET /token/expired", s.checkTokenExpiry, public},
+
+		{"GET /users/{id}", s.userGetOne, requires(database.PermissionUsersRead)},
+		{"POST /users", s.userCreate, requires(database.PermissionUsersWrite)},
+		{"DELETE /users/{id}", s.userDelete, requires(database.PermissionUsersDelete)},
+		{"PATCH /users/{id}", s.userPatch, requires(database.PermissionUsersWrite)},
+		{"GET /users", s.getUsers, requires(database.PermissionUsersRead)},
+		{"POST /users/login", s.login, public},
+		{"POST /users/login/mfa", s.loginMFA, public},
+		{"POST /users/me/mfa/totp", s.totpEnroll, authenticated.withoutMFA()},
+		{"POST /users/me/mfa/totp/confirm", s.totpConfirm, authenticated.withoutMFA()},
+		{"DELETE /users/me/mfa/totp", s.totpDisable, authenticated},
+		{"POST /users/me/mfa/recovery-codes", s.mfaRecoveryCodesRegenerate, authenticated},
+		{"POST /users/token/refresh", s.refreshToken, public},
+		{"POST /users/logout", s.logout, public},
+		{"GET /users/me", s.meGet, authenticated.withoutMFA()},
+		{"PATCH /users/me", s.mePatch, authenticated},
+		{"POST /users/me/password", s.mePasswordChange, authenticated},
+		{"POST /users/me/email", s.meEmailChange, authenticated},
+		{"PUT /users/email", s.emailChangeConfirm, public},
+		{"GET /users/me/shops", s.myShops, authenticated},
+		{"GET /users/me/sessions", s.mySessions, authenticated.withoutMFA()},
+		{"DELETE /users/{id}/sessions", s.userSessionsDelete, authenticated},
+		{"POST /users/{id}/unlock", s.userUnlock, requires(database.PermissionUsersWrite)},
+		{"POST /users/{id}/api-keys", s.apiKeyCreate, requires(database.PermissionAPIKeysManage)},
+		{"GET /users/{id}/api-keys", s.apiKeyGetAll, requires(database.PermissionAPIKeysManage)},
+		{"DELETE /users/{id}/api-keys/{keyId}", s.apiKeyRevoke, requires(database.PermissionAPIKeysManage)},
+		{"PUT /users/activated", s.activate, public},
+		{"GET /users/activate", s.activateLink, public},
+		{"POST /users/activation/resend", s.resendActivation, public},
+		{"POST /users/password/forgot", s.forgotPassword, public},
+		{"POST /users/password/reset", s.resetPassword, public},
+
+		{"GET /shops/{id}", s.shopGetOne, public},
+		{"POST /shops", s.shopCreate, requires(database.PermissionShopsCreate).withScope(database.ScopeShopsWrite)},
+		{"DELETE /shops/{id}", s.shopDelete, authenticated.withScope(database.ScopeShopsWrite)},
+		{"PATCH /shops/approval/{id}", s.updateAppoval, requires(database.PermissionShopsApprove)},
+		{"PATCH /shops/{id}", s.shopPatch, authenticated.withScope(database.ScopeShopsWrite)},
+		{"POST /shops/{id}/resubmit", s.shopResubmit, authenticated.withScope(database.ScopeShopsWrite)},
+		{"GET /shops/{id}/approval-history", s.shopApprovalHistory, authenticated},
+		{"GET /shops/{id}/hours", s.shopHoursGet, public},
+		{"PUT /shops/{id}/hours", s.shopHoursReplace, authenticated.withScope(database.ScopeShopsWrite)},
+		{"POST /shops/{id}/closures", s.shopClosureCreate, authenticated.withScope(database.ScopeShopsWrite)},
+		{"DELETE /shops/{id}/closures/{closureId}", s.shopClosureDelete, authenticated.withScope(database.ScopeShopsWrite)},
+		{"GET /shops", s.getShops, public},
+		{"POST /shops/search/within", s.shopSearchWithin, public},
+		{"GET /shops/clusters", s.getShopClusters, public},
+		{"GET /search/suggest", s.searchSuggest, public},
+		{"GET /tiles/shops/{z}/{x}/{y}", s.shopTile, public},
+
+		{"GET /moderation/shops", s.moderationQueue, requires(database.PermissionShopsApprove)},
+		{"GET /moderation/stats", s.moderationStats, requires(database.PermissionShopsApprove)},
+		{"POST /moderation/shops/{id}/claim", s.moderationClaim, requires(database.PermissionShopsApprove)},
+		{"DELETE /moderation/shops/{id}/claim", s.moderationRelease, requires(database.PermissionShopsApprove)},
+		{"POST /moderation/shops/{id}/decision", s.moderationDecide, requires(database.PermissionShopsApprove)},
+
+		{"GET /categories/{id}", s.catGetOne, public},
+		{"POST /categories", s.catCreate, requires(database.PermissionCategoriesWrite).withScope(database.ScopeCategoriesWrite)},
+		{"DELETE /categories/{id}", s.catDelete, requires(database.PermissionCategoriesWrite).withScope(database.ScopeCategoriesWrite)},
+		{"PUT /categories/{id}", s.catPut, requires(database.PermissionCategoriesWrite).withScope(database.ScopeCategoriesWrite)},
+		{"GET /categories", s.catGetAll, public},
+		{"GET /categories/tree", s.catTree, public},
+		{"POST /categories/{id}/move", s.catMove, requires(database.PermissionCategoriesWrite).withScope(database.ScopeCategoriesWrite)},
+		{"PUT /categories/{id}/labels/{locale}", s.catLabelPut, requires(database.PermissionCategoriesWrite).withScope(database.ScopeCategoriesWrite)},
+		{"DELETE /categories/{id}/labels/{locale}", s.catLabelDelete, requires(database.PermissionCategoriesWrite).withScope(database.ScopeCategoriesWrite)},
+
+		{"GET /values/{id}", s.catMemberGetOne, public},
+		{"POST /values", s.catMemberCreate, requires(database.PermissionCategoriesWrite).withScope(database.ScopeCategoriesWrite)},
+		{"DELETE /values/{id}", s.catMemberDelete, requires(database.PermissionCategoriesWrite).withScope(database.ScopeCategoriesWrite)},
+		{"PATCH /values/{id}", s.catMemberPut, requires(database.PermissionCategoriesWrite).withScope(database.ScopeCategoriesWrite)},
+		{"GET /values", s.catMemberGetAll, public},
+		{"PUT /values/{id}/labels/{locale}", s.catMemberLabelPut, requires(database.PermissionCategoriesWrite).withScope(database.ScopeCategoriesWrite)},
+		{"DELETE /values/{id}/labels/{locale}", s.catMemberLabelDelete, requires(database.PermissionCategoriesWrite).withScope(database.ScopeCategoriesWrite)},
+
+		{"POST /shopCategories", s.scCreate, requires(database.PermissionCategoriesWrite).withScope(database.ScopeCategoriesWrite)},
+
+		{"GET /roles", s.roleGetAll, requires(database.PermissionRolesManage)},
+		{"POST /roles", s.roleCreate, requires(database.PermissionRolesManage)},
+		{"GET /roles/{id}", s.roleGetOne, requires(database.PermissionRolesManage)},
+		{"PATCH /roles/{id}", s.rolePatch, requires(database.PermissionRolesManage)},
+		{"DELETE /roles/{id}", s.roleDelete, requires(database.PermissionRolesManage)},
+		{"GET /permissions", s.permissionGetAll, requires(database.PermissionRolesManage)},
+
+		{"GET /.well-known/jwks.json", s.jwksHandler, public},
+
+		{"/health", s.healthHandler, public},
+	}
+}
+
 func (s *Server) RegisterRoutes() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("POST /file/upload", s.uploadFile)
-	mux.HandleFunc("GET /file/fetch", s.fetchFile)
-	mux.HandleFunc("DELETE /file", s.deleteFile)
-	// Register routes
-	// mux.HandleFunc("/", s.HelloWorldHandler)
-	mux.HandleFunc("GET /token/expired", s.checkTokenExpiry)
-
-	mux.HandleFunc("GET /users/{id}", s.userGetOne)
-	mux.HandleFunc("POST /users", s.userCreate)
-	mux.HandleFunc("DELETE /users/{id}", s.userDelete)
-	mux.HandleFunc("PATCH /users/{id}", s.userPatch)
-	mux.HandleFunc("GET /users", s.getUsers)
-	mux.HandleFunc("POST /users/login", s.login)
-	mux.HandleFunc("POST /users/token/refresh", s.refreshToken)
-	mux.HandleFunc("PUT /users/activated", s.activate)
-	mux.HandleFunc("POST /users/password/forgot", s.forgotPassword)
-
-	mux.HandleFunc("POST /users/password/reset", s.resetPassword)
-
-	mux.HandleFunc("GET /shops/{id}", s.shopGetOne)
-	// mux.HandleFunc("POST /shops", s.shopCreate)
-	mux.HandleFunc("POST /shops", s.RoleMiddleware(s.shopCreate, "ADMIN", "OPERATOR"))
-	mux.HandleFunc("DELETE /shops/{id}", s.shopDelete)
-	mux.HandleFunc("PATCH /shops/approval/{id}", s.updateAppoval)
-	mux.HandleFunc("PATCH /shops/{id}", s.shopPatch)
-	mux.HandleFunc("GET /shops", s.getShops)
-
-	mux.HandleFunc("GET /categories/{id}", s.catGetOne)
-	mux.HandleFunc("POST /categories", s.catCreate)
-	mux.HandleFunc("DELETE /categories/{id}", s.catDelete)
-	mux.HandleFunc("PUT /categories/{id}", s.catPut)
-	mux.HandleFunc("GET /categories", s.catGetAll)
-
-	mux.HandleFunc("GET /values/{id}", s.catMemberGetOne)
-	mux.HandleFunc("POST /values", s.catMemberCreate)
-	mux.HandleFunc("DELETE /values/{id}", s.catMemberDelete)
-	mux.HandleFunc("PATCH /values/{id}", s.catMemberPut)
-	// mux.HandleFunc("GET /values", s.catMemberGetAll)
-	mux.HandleFunc("GET /values", s.RoleMiddleware(s.catMemberGetAll, "OPERATOR"))
-
-	mux.HandleFunc("POST /shopCategories", s.scCreate)
-
-	mux.HandleFunc("/health", s.healthHandler)
+	for _, rt := range s.routes() {
+		mux.HandleFunc(rt.pattern, s.authorize(rt.handler, rt.access))
+	}
 
 	// Wrap the mux with CORS middleware
-	return s.corsMiddleware(mux)
+	return s.corsMiddleware(s.authenticate(mux))
 }
 
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+func (ser Server) searchSuggest(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	q := strings.TrimSpace(ser.parseString(r, "q", ""))
+	limit := ser.parseInt(r, "limit", 10, v)
+
+	v.Check(q != "", "q", "must be provided")
+	v.Check(len(q) <= 100, "q", "must not be more than 100 bytes long")
+	v.Check(limit > 0 && limit <= 20, "limit", "must be between 1 and 20")
+	if !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := ser.models.Search.Suggest(q, limit)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
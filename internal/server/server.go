@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Mahider-T/autoSphere/internal/database"
@@ -19,6 +20,19 @@ type Server struct {
 	db     database.Service
 	logger *jsonlog.Logger
 	mailer mailer.Mailer
+	keys   *keyring
+
+	// Base URL of the web app, used for links in emails.
+	frontendURL string
+	// Public base URL of this API, used for links that hit the API directly.
+	baseURL string
+
+	activationLimiter *rateLimiter
+	permissions       *permissionCache
+
+	// Roles that must pass a second factor before using role-protected routes
+	// in addition to those marked mfa_required. Matched by name.
+	mfaRoles []database.Role
 }
 
 func NewServer() *http.Server {
@@ -31,13 +45,42 @@ func NewServer() *http.Server {
 	smtp_username := os.Getenv("SMTP_USERNAME")
 	smtp_password := os.Getenv("SMTP_PASSWORD")
 	smtp_sender := os.Getenv("SMTP_SENDER")
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://autosphere.com"
+	}
+	baseURL := os.Getenv("API_BASE_URL")
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("http://localhost:%d", port)
+	}
+
+	keys, err := newKeyring(
+		os.Getenv("JWT_SIGNING_ALG"),
+		os.Getenv("JWT_SIGNING_KEY_ID"),
+		os.Getenv("JWT_SIGNING_KEY"),
+		os.Getenv("JWT_PREVIOUS_KEYS"),
+	)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	db, dbConn := database.New()
+	models := database.NewModels(dbConn)
 	NewServer := &Server{
 		port:   port,
 		db:     db,
-		models: database.NewModels(dbConn),
+		models: models,
 		logger: logger,
 		mailer: mailer.New(smtp_host, smtp_port, smtp_username, smtp_password, smtp_sender),
+		keys:   keys,
+
+		frontendURL: frontendURL,
+		baseURL:     baseURL,
+
+		activationLimiter: newRateLimiter(5 * time.Minute),
+		permissions:       newPermissionCache(time.Minute, models.Roles.PermissionsByRole),
+
+		mfaRoles: parseRoles(os.Getenv("MFA_REQUIRED_ROLES")),
 	}
 
 	// Declare Server config
@@ -51,3 +94,15 @@ func NewServer() *http.Server {
 
 	return server
 }
+
+// parseRoles reads a comma separated role list. An unset or empty variable
+// names no roles.
+func parseRoles(csv string) []database.Role {
+	roles := []database.Role{}
+	for _, role := range strings.Split(csv, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, database.Role(role))
+		}
+	}
+	return roles
+}
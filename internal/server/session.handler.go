@@ -0,0 +1,75 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+)
+
+func (ser Server) logout(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Refresh_Token string `json:"refresh_token"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Logging out with an unknown or already revoked token is not an error;
+	// the caller ends up logged out either way.
+	err := ser.models.Sessions.RevokeFamily(input.Refresh_Token)
+	if err != nil && !errors.Is(err, database.ErrRecordNotFound) {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"message": "logged out"}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) userSessionsDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	if contextGetPrincipal(r).UserId != id {
+		granted, err := ser.can(r, database.PermissionSessionsManage)
+		if err != nil {
+			ser.serverErrorResponse(w, r, err)
+			return
+		}
+		if !granted {
+			ser.forbiddenErrorResponse(w, r)
+			return
+		}
+	}
+
+	if err = ser.models.Sessions.RevokeAllForUser(id); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"message": "sessions successfully revoked"}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) mySessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := ser.models.Sessions.GetAllForUser(contextGetPrincipal(r).UserId)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
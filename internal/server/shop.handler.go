@@ -3,7 +3,10 @@ package server
 import (
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/Mahider-T/autoSphere/internal/database"
 	"github.com/Mahider-T/autoSphere/validator"
@@ -11,23 +14,32 @@ import (
 
 func (ser *Server) shopCreate(w http.ResponseWriter, r *http.Request) {
 
-	userId := r.Context().Value(UserIDKey).(float64)
+	userId := contextGetPrincipal(r).UserId
 
 	var input struct {
-		Name            string                      `json:"name"`
-		Phone_Number    string                      `json:"phone_number"`
-		Email           string                      `json:"email"`
-		Location        string                      `json:"location"`
-		Coordinate      string                      `json:"coordinate"`
-		Category        []string                    `json:"category"`
-		Thumbnail       string                      `json:"thumbnail"`
-		Photos          []string                    `json:"photos"`
-		Files           []string                    `json:"files"`
-		Approval_Status database.ShopApprovalStatus `json:"approval_status"`
+		Name            string                       `json:"name"`
+		Phone_Number    string                       `json:"phone_number"`
+		Email           string                       `json:"email"`
+		Location        string                       `json:"location"`
+		Latitude        *float64                     `json:"latitude"`
+		Longitude       *float64                     `json:"longitude"`
+		Category        []database.CategoryMemberRef `json:"category"`
+		Thumbnail       string                       `json:"thumbnail"`
+		Photos          []string                     `json:"photos"`
+		Files           []string                     `json:"files"`
+		Approval_Status database.ShopApprovalStatus  `json:"approval_status"`
 	}
 
 	if err := ser.readJSON(w, r, &input); err != nil {
-		ser.serverErrorResponse(w, r, err)
+		ser.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Latitude != nil, "latitude", "latitude must be provided")
+	v.Check(input.Longitude != nil, "longitude", "longitude must be provided")
+	if !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
@@ -36,7 +48,8 @@ func (ser *Server) shopCreate(w http.ResponseWriter, r *http.Request) {
 		Phone_Number:    input.Phone_Number,
 		Email:           input.Email,
 		Location:        input.Location,
-		Coordinate:      input.Coordinate,
+		Latitude:        *input.Latitude,
+		Longitude:       *input.Longitude,
 		Thumbnail:       &input.Thumbnail,
 		Photos:          input.Photos,
 		Files:           input.Files,
@@ -44,14 +57,22 @@ func (ser *Server) shopCreate(w http.ResponseWriter, r *http.Request) {
 		Created_By:      int(userId),
 	}
 
-	v := validator.New()
 	if database.ValidateShop(v, &shop); !v.Valid() {
 		ser.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	if err := ser.models.Shops.Create(&shop); err != nil {
-		ser.serverErrorResponse(w, r, err)
+	if err := ser.models.Shops.Create(&shop, input.Category, responseLocale(w, r)); err != nil {
+		switch {
+		case errors.Is(err, database.ErrUnknownCategoryMember):
+			v.AddError("category", "contains a category member that does not exist")
+			ser.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, database.ErrAmbiguousCategoryMember):
+			v.AddError("category", "contains a slug used in several categories; write it as category:slug")
+			ser.failedValidationResponse(w, r, v.Errors)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -70,7 +91,7 @@ func (ser Server) shopGetOne(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	shop, err := ser.models.Shops.Get(id)
+	shop, err := ser.models.Shops.Get(id, responseLocale(w, r))
 	if err != nil {
 		switch {
 		case errors.Is(err, database.ErrRecordNotFound):
@@ -81,6 +102,19 @@ func (ser Server) shopGetOne(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	visibility, err := ser.shopVisibility(r)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+	if !visibility.Allows(shop) {
+		ser.notFoundResponse(w, r)
+		return
+	}
+	if !visibility.ShowsContact(shop) {
+		shop.RedactContact()
+	}
+
 	err = ser.writeJSON(w, http.StatusOK, envelope{"shop": shop}, nil)
 	if err != nil {
 		ser.serverErrorResponse(w, r, err)
@@ -94,6 +128,27 @@ func (ser Server) shopDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	shop, err := ser.models.Shops.Get(id, database.DefaultLocale)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	allowed, err := ser.canModifyShop(r, shop)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+	if !allowed {
+		ser.forbiddenErrorResponse(w, r)
+		return
+	}
+
 	if err = ser.models.Shops.Delete(id); err != nil {
 		switch {
 		case errors.Is(err, database.ErrRecordNotFound):
@@ -117,7 +172,7 @@ func (ser Server) shopPatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	shop, err := ser.models.Shops.Get(id)
+	shop, err := ser.models.Shops.Get(id, database.DefaultLocale)
 	if err != nil {
 		switch {
 		case errors.Is(err, database.ErrRecordNotFound):
@@ -128,20 +183,31 @@ func (ser Server) shopPatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	allowed, err := ser.canModifyShop(r, shop)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+	if !allowed {
+		ser.forbiddenErrorResponse(w, r)
+		return
+	}
+
 	var input struct {
-		Name         *string   `json:"name"`
-		Phone_Number *string   `json:"phone_number"`
-		Email        *string   `json:"email"`
-		Location     *string   `json:"location"`
-		Coordinate   *string   `json:"coordinate"`
-		Category     *[]string `json:"category"`
-		Thumbnail    *string   `json:"thumbnail"`
-		Photos       *[]string `json:"photos"`
+		Name         *string                       `json:"name"`
+		Phone_Number *string                       `json:"phone_number"`
+		Email        *string                       `json:"email"`
+		Location     *string                       `json:"location"`
+		Latitude     *float64                      `json:"latitude"`
+		Longitude    *float64                      `json:"longitude"`
+		Category     *[]database.CategoryMemberRef `json:"category"`
+		Thumbnail    *string                       `json:"thumbnail"`
+		Photos       *[]string                     `json:"photos"`
 	}
 
 	err = ser.readJSON(w, r, &input)
 	if err != nil {
-		ser.serverErrorResponse(w, r, err)
+		ser.badRequestResponse(w, r, err)
 		return
 	}
 
@@ -160,22 +226,33 @@ func (ser Server) shopPatch(w http.ResponseWriter, r *http.Request) {
 	if input.Photos != nil {
 		shop.Photos = *input.Photos
 	}
-	if input.Coordinate != nil {
+	if input.Latitude != nil {
+		shop.Latitude = *input.Latitude
+	}
+	if input.Longitude != nil {
+		shop.Longitude = *input.Longitude
+	}
 
-		shop.Coordinate = *input.Coordinate
-	} else {
-		coords := shop.Coordinate
-		if coords != "" {
-			// Strip "POINT()" and spaces, extracting just the longitude and latitude
-			coords = coords[6 : len(coords)-1]
-			// Now coords contains the "longitude latitude" format
-			shop.Coordinate = coords
-		}
+	v := validator.New()
+	if database.ValidateShop(v, shop); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
-	err = ser.models.Shops.Patch(shop)
+	err = ser.models.Shops.Patch(shop, input.Category, responseLocale(w, r))
 	if err != nil {
-		ser.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, database.ErrUnknownCategoryMember):
+			v.AddError("category", "contains a category member that does not exist")
+			ser.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, database.ErrAmbiguousCategoryMember):
+			v.AddError("category", "contains a slug used in several categories; write it as category:slug")
+			ser.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -184,73 +261,355 @@ func (ser Server) shopPatch(w http.ResponseWriter, r *http.Request) {
 		ser.serverErrorResponse(w, r, err)
 	}
 }
-func (ser Server) getShops(w http.ResponseWriter, r *http.Request) {
+
+// canModifyShop reports whether the caller may edit or delete shop. Holders of
+// shops:write may change any shop; everyone else only the ones they created,
+// and only until they are approved.
+func (ser Server) canModifyShop(r *http.Request, shop *database.Shop) (bool, error) {
+	granted, err := ser.can(r, database.PermissionShopsWrite)
+	if err != nil || granted {
+		return granted, err
+	}
+	return int64(shop.Created_By) == contextGetPrincipal(r).UserId && shop.EditableByCreator(), nil
+}
+
+func (ser Server) myShops(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Name             string
-		Coordinate       string
-		Max_Distance     int
-		Category_Members []string
-		Filters          database.Filters
+		Approval_Status string
+		Filters         database.Filters
 	}
 
 	v := validator.New()
 
-	// Parse query parameters
-	input.Name = ser.parseString(r, "name", "")
-	input.Coordinate = ser.parseString(r, "coordinate", "")
-	input.Max_Distance = ser.parseInt(r, "max_dist", 10, v)
-
+	input.Approval_Status = ser.parseString(r, "approval_status", "")
 	input.Filters.Page = ser.parseInt(r, "page", 1, v)
 	input.Filters.PageSize = ser.parseInt(r, "page_size", 20, v)
-	input.Filters.Sort = ser.parseString(r, "sort", "id")
+	input.Filters.Sort = ser.parseString(r, "sort", "-created_at")
 	input.Filters.SortSafelist = []string{"id", "name", "created_at", "-id", "-name", "-created_at"}
 
-	category_members, err := ser.parseCSV(r, "category_members", []string{})
+	if input.Approval_Status != "" {
+		v.Check(validator.In(input.Approval_Status, string(database.PENDING), string(database.APPROVED), string(database.DECLINED)), "approval_status", "must be one of PENDING, APPROVED or DECLINED")
+	}
+	if database.ValidateFilters(v, input.Filters); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	shops, metadata, err := ser.models.Shops.GetAllForUser(contextGetPrincipal(r).UserId, input.Approval_Status, responseLocale(w, r), input.Filters)
 	if err != nil {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
-	input.Category_Members = category_members
-	// fmt.Print("Category members are :- ", input.Category_Members)
-	// Validate filters
-	if database.ValidateFilters(v, input.Filters); !v.Valid() {
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "shops": shops}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+// shopVisibility works out which shops the caller may see. Holders of
+// shops:write or shops:approve see all of them, API keys only when they also
+// carry the shops:read scope.
+func (ser Server) shopVisibility(r *http.Request) (database.ShopVisibility, error) {
+	p := contextGetPrincipal(r)
+	visibility := database.ShopVisibility{ViewerId: p.UserId}
+
+	if p.IsAnonymous() || (p.IsAPIKey() && !validator.In(database.ScopeShopsRead, p.Scopes...)) {
+		return visibility, nil
+	}
+
+	for _, permission := range []string{database.PermissionShopsWrite, database.PermissionShopsApprove} {
+		granted, err := ser.can(r, permission)
+		if err != nil {
+			return visibility, err
+		}
+		if granted {
+			visibility.All = true
+			break
+		}
+	}
+	return visibility, nil
+}
+
+func (ser Server) getShops(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	input, err := ser.readShopFilter(r, v)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
 		ser.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	// Fetch shops
-	shops, metadata, err := ser.models.Shops.GetAll(input.Name, input.Coordinate, input.Max_Distance, input.Filters, input.Category_Members)
+	ser.listShops(w, r, input)
+}
+
+// shopSearchWithin lists the shops inside the GeoJSON Polygon or MultiPolygon
+// sent as the body. The query string takes the same filters as GET /shops.
+func (ser Server) shopSearchWithin(w http.ResponseWriter, r *http.Request) {
+	var geometry database.Geometry
+
+	if err := ser.readJSON(w, r, &geometry); err != nil {
+		ser.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	input, err := ser.readShopFilter(r, v)
 	if err != nil {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
+	database.ValidateGeometry(v, "geometry", geometry)
+	if !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	input.Within = &geometry
 
-	// Return JSON response
-	ser.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "shops": shops}, nil)
+	ser.listShops(w, r, input)
 }
 
-func (ser Server) updateAppoval(w http.ResponseWriter, r *http.Request) {
+// readShopFilter parses the shop listing query parameters and scopes the
+// filter to what the caller may see. Problems with the parameters are
+// recorded on v.
+func (ser Server) readShopFilter(r *http.Request, v *validator.Validator) (database.ShopFilter, error) {
+	visibility, err := ser.shopVisibility(r)
+	if err != nil {
+		return database.ShopFilter{}, err
+	}
 
-	id, err := ser.readIDParam(r)
+	input := database.ShopFilter{Visibility: visibility}
+
+	// Parse query parameters
+	input.Name = ser.parseString(r, "name", "")
+	input.Query = ser.parseString(r, "q", "")
+	input.Near = ser.parseGeoPoint(r, v)
+	input.RadiusM = ser.parseFloat(r, "radius_m", 5000, v)
+	input.BBox = ser.parseBoundingBox(r, "bbox", v)
+
+	input.OpenAt = ser.parseTime(r, "open_at", v)
+	if ser.parseBool(r, "open_now", false, v) {
+		v.Check(input.OpenAt == nil, "open_now", "must not be combined with open_at")
+		now := time.Now()
+		input.OpenAt = &now
+	}
+
+	input.Filters.Page = ser.parseInt(r, "page", 1, v)
+	input.Filters.PageSize = ser.parseInt(r, "page_size", 20, v)
+	input.Filters.Sort = ser.parseString(r, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "name", "created_at", "-id", "-name", "-created_at"}
+	if input.Near != nil {
+		// Geo searches are nearest first unless asked otherwise.
+		input.Filters.Sort = ser.parseString(r, "sort", "distance")
+		input.Filters.SortSafelist = append(input.Filters.SortSafelist, "distance", "-distance")
+		v.Check(input.RadiusM > 0, "radius_m", "must be greater than zero")
+		v.Check(input.RadiusM <= 100_000, "radius_m", "must be a maximum of 100000")
+	}
+	if input.Query != "" {
+		// Text searches are best match first, which takes precedence over
+		// distance; distance can still be asked for explicitly.
+		input.Filters.Sort = ser.parseString(r, "sort", "relevance")
+		input.Filters.SortSafelist = append(input.Filters.SortSafelist, "relevance")
+		v.Check(len(input.Query) <= 200, "q", "must not be more than 200 bytes long")
+	}
+
+	category_members, err := ser.parseCategoryMembers(r, v)
 	if err != nil {
-		ser.notFoundResponse(w, r)
+		return database.ShopFilter{}, err
+	}
+	input.CategoryMembers = category_members
+	input.CategoryClauses = ser.parseCategoryFilter(r, v)
+	if err := ser.checkCategoryMembers(v, input.CategoryMembers); err != nil {
+		return database.ShopFilter{}, err
+	}
+	if err := ser.checkCategoryClauses(v, "category_filter", input.CategoryClauses); err != nil {
+		return database.ShopFilter{}, err
+	}
+
+	// Callers who only see approved shops can still narrow down to their own
+	// pending or declined submissions.
+	statuses, err := ser.parseCSV(r, "approval_status", []string{})
+	if err != nil {
+		return database.ShopFilter{}, err
+	}
+	for _, status := range statuses {
+		v.Check(validator.In(status, string(database.PENDING), string(database.APPROVED), string(database.DECLINED)), "approval_status", "must be one or more of PENDING, APPROVED or DECLINED")
+		input.ApprovalStatuses = append(input.ApprovalStatuses, database.ShopApprovalStatus(status))
+	}
+
+	database.ValidateFilters(v, input.Filters)
+
+	return input, nil
+}
+
+// parseCategoryMembers reads the category_members query parameter, a comma
+// separated list of slugs, each optionally qualified as category:slug.
+func (ser Server) parseCategoryMembers(r *http.Request, v *validator.Validator) ([]database.CategoryMemberRef, error) {
+	values, err := ser.parseCSV(r, "category_members", []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []database.CategoryMemberRef{}
+	for _, value := range values {
+		ref := database.ParseCategoryMemberRef(value)
+		if ref.Slug == "" || (ref.Category == "" && strings.Contains(value, ":")) {
+			v.AddError("category_members", "must be slugs or category:slug pairs")
+			return nil, nil
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// checkCategoryMembers records on v any category_members values that name
+// nothing, or that name members of several categories without saying which.
+// It skips the lookup once v has errors.
+func (ser Server) checkCategoryMembers(v *validator.Validator, refs []database.CategoryMemberRef) error {
+	if len(refs) == 0 || !v.Valid() {
+		return nil
+	}
+
+	unknown, ambiguous, err := ser.models.Category.CheckMemberFilter(refs)
+	if err != nil {
+		return err
+	}
+	v.Check(len(unknown) == 0, "category_members", "unknown category or member: "+strings.Join(unknown, ", "))
+	v.Check(len(ambiguous) == 0, "category_members", "ambiguous member, write it as category:slug: "+strings.Join(ambiguous, ", "))
+	return nil
+}
+
+// parseCategoryFilter reads the category_filter query parameter.
+func (ser Server) parseCategoryFilter(r *http.Request, v *validator.Validator) []database.CategoryClause {
+	return database.ParseCategoryClauses(v, "category_filter", ser.parseString(r, "category_filter", ""))
+}
+
+// checkCategoryClauses records on v any category filter values that don't
+// name a member of their category. It skips the lookup once v has errors.
+func (ser Server) checkCategoryClauses(v *validator.Validator, key string, clauses []database.CategoryClause) error {
+	if len(clauses) == 0 || !v.Valid() {
+		return nil
+	}
+
+	unknown, err := ser.models.Category.UnknownClauseValues(clauses)
+	if err != nil {
+		return err
+	}
+	v.Check(len(unknown) == 0, key, "unknown category or value: "+strings.Join(unknown, ", "))
+	return nil
+}
+
+// Map clusters are sized so a 256px tile holds clusterCellsPerTile cells
+// across, which keeps markers roughly 64px apart at any zoom.
+const clusterCellsPerTile = 4
+
+// maxClusterCells caps the grid a viewport may span at the requested zoom, and
+// so the number of clusters returned. A full HD screen spans about 500 cells.
+const maxClusterCells = 2000
+
+// getShopClusters groups the approved shops in the viewport for zoomed-out map
+// views. Only the name, category_members and category_filter filters apply.
+func (ser Server) getShopClusters(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	input := database.ShopFilter{}
+	input.Name = ser.parseString(r, "name", "")
+	input.BBox = ser.parseBoundingBox(r, "bbox", v)
+	zoom := ser.parseInt(r, "zoom", -1, v)
+
+	category_members, err := ser.parseCategoryMembers(r, v)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+	input.CategoryMembers = category_members
+	input.CategoryClauses = ser.parseCategoryFilter(r, v)
+	if err := ser.checkCategoryMembers(v, input.CategoryMembers); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+	if err := ser.checkCategoryClauses(v, "category_filter", input.CategoryClauses); err != nil {
+		ser.serverErrorResponse(w, r, err)
 		return
 	}
 
-	var input struct {
-		Approval_Status database.ShopApprovalStatus `json:"approval_status"`
+	v.Check(input.BBox != nil, "bbox", "must be provided")
+	v.Check(zoom >= 0 && zoom <= 22, "zoom", "must be between 0 and 22")
+	if !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
-	if err := ser.readJSON(w, r, &input); err != nil {
+	cellSize := 360 / math.Pow(2, float64(zoom)) / clusterCellsPerTile
+
+	width := input.BBox.MaxLng - input.BBox.MinLng
+	if width < 0 {
+		width += 360
+	}
+	cells := math.Ceil(width/cellSize) * math.Ceil((input.BBox.MaxLat-input.BBox.MinLat)/cellSize)
+	if v.Check(cells <= maxClusterCells, "bbox", "is too large for this zoom level"); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	clusters, err := ser.models.Shops.Clusters(input, cellSize, maxClusterCells)
+	if err != nil {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
 
-	if err := ser.models.Shops.UpdateAppoval(id, input.Approval_Status); err != nil {
+	err = ser.writeJSON(w, http.StatusOK, envelope{"zoom": zoom, "clusters": clusters}, nil)
+	if err != nil {
 		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) listShops(w http.ResponseWriter, r *http.Request, input database.ShopFilter) {
+	v := validator.New()
+	withFacets := ser.parseBool(r, "facets", false, v)
+	if !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	ser.writeJSON(w, http.StatusOK, envelope{"id": id, "approval_status": input.Approval_Status}, nil)
+	input.Locale = responseLocale(w, r)
+	shops, metadata, err := ser.models.Shops.GetAll(input)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
 
+	for i := range shops {
+		if !input.Visibility.ShowsContact(&shops[i]) {
+			shops[i].RedactContact()
+		}
+	}
+
+	var facets database.ShopFacets
+	if withFacets {
+		facets, err = ser.models.Shops.Facets(input)
+		if err != nil {
+			ser.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if wantsGeoJSON(r) {
+		err = ser.writeShopsGeoJSON(w, http.StatusOK, shops, metadata, facets)
+	} else {
+		env := envelope{"metadata": metadata, "shops": shops}
+		if withFacets {
+			env["facets"] = facets
+		}
+		err = ser.writeJSON(w, http.StatusOK, env, nil)
+	}
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
 }
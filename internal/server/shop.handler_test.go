@@ -0,0 +1,128 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+// Bodies that don't decode are the client's fault and must not reach the
+// database, so a Server without models can answer them.
+func TestShopWriteRejectsUndecodableBodies(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"badly formed JSON", `{"name": `},
+		{"category of booleans", `{"category": [true]}`},
+		{"category of objects", `{"category": [{"id": 1}]}`},
+		{"category not a list", `{"category": "toyota"}`},
+	}
+
+	ser := &Server{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			ser.shopCreate(rr, httptest.NewRequest(http.MethodPost, "/shops", strings.NewReader(tt.body)))
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body)
+			}
+		})
+	}
+}
+
+func TestShopSearchWithinRejectsUndecodableBodies(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"badly formed JSON", `{"type": `},
+		{"not an object", `["Polygon"]`},
+		{"type not a string", `{"type": 5}`},
+	}
+
+	ser := &Server{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			ser.shopSearchWithin(rr, httptest.NewRequest(http.MethodPost, "/shops/search/within", strings.NewReader(tt.body)))
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body)
+			}
+		})
+	}
+}
+
+// category_filter arrives in a URL, so its markers must survive query string
+// decoding as typed by hand or as escaped by a client library.
+func TestParseCategoryFilterFromURL(t *testing.T) {
+	want := []database.CategoryClause{
+		{Category: "brand", AnyOf: []string{"toyota", "nissan"}},
+		{Category: "service", AllOf: []string{"tires", "brakes"}, NoneOf: []string{"towing"}},
+	}
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"as typed", "/shops?category_filter=brand:toyota|nissan,service:*tires*brakes|!towing"},
+		{"escaped", "/shops?category_filter=brand%3Atoyota%7Cnissan%2Cservice%3A%2Atires%2Abrakes%7C%21towing"},
+		{"among other parameters", "/shops?page=1&category_filter=brand:toyota|nissan,service:*tires*brakes|!towing&sort=name"},
+	}
+
+	ser := Server{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			clauses := ser.parseCategoryFilter(httptest.NewRequest(http.MethodGet, tt.url, nil), v)
+
+			if !v.Valid() {
+				t.Fatalf("unexpected errors %v", v.Errors)
+			}
+			if !reflect.DeepEqual(clauses, want) {
+				t.Errorf("expected %+v, got %+v", want, clauses)
+			}
+		})
+	}
+}
+
+func TestParseCategoryMembers(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		want  []database.CategoryMemberRef
+		valid bool
+	}{
+		{"absent", "/shops", []database.CategoryMemberRef{}, true},
+		{"slugs", "/shops?category_members=brand,toyota", []database.CategoryMemberRef{{Slug: "brand"}, {Slug: "toyota"}}, true},
+		{"qualified", "/shops?category_members=service:other,Brand:Other", []database.CategoryMemberRef{{Category: "service", Slug: "other"}, {Category: "brand", Slug: "other"}}, true},
+		{"empty value", "/shops?category_members=toyota,,nissan", nil, false},
+		{"missing slug", "/shops?category_members=brand:", nil, false},
+		{"missing category", "/shops?category_members=:other", nil, false},
+	}
+
+	ser := Server{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			refs, err := ser.parseCategoryMembers(httptest.NewRequest(http.MethodGet, tt.url, nil), v)
+			if err != nil {
+				t.Fatalf("parseCategoryMembers: %v", err)
+			}
+
+			if v.Valid() != tt.valid {
+				t.Fatalf("expected valid=%t, got errors %v", tt.valid, v.Errors)
+			}
+			if tt.valid && !reflect.DeepEqual(refs, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, refs)
+			}
+		})
+	}
+}
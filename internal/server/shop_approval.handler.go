@@ -0,0 +1,212 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+func (ser Server) updateAppoval(w http.ResponseWriter, r *http.Request) {
+
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Approval_Status database.ShopApprovalStatus `json:"approval_status"`
+		Reason          string                      `json:"reason"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	actorId := contextGetPrincipal(r).UserId
+	event := &database.ShopApprovalEvent{
+		ShopId:  id,
+		ActorId: &actorId,
+		To:      input.Approval_Status,
+		Reason:  input.Reason,
+	}
+
+	v := validator.New()
+	v.Check(event.To != database.PENDING, "approval_status", "must be APPROVED or DECLINED")
+	if database.ValidateApprovalEvent(v, event); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !ser.transitionShop(w, r, event) {
+		return
+	}
+
+	ser.notifyShopReview(event)
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"id": id, "approval_status": event.To, "event": event}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+// shopResubmit sends a declined shop back to the review queue, typically after
+// the creator addressed the reviewer's reason.
+func (ser Server) shopResubmit(w http.ResponseWriter, r *http.Request) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	shop, err := ser.models.Shops.Get(id, database.DefaultLocale)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	allowed, err := ser.canModifyShop(r, shop)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+	if !allowed {
+		ser.forbiddenErrorResponse(w, r)
+		return
+	}
+
+	actorId := contextGetPrincipal(r).UserId
+	event := &database.ShopApprovalEvent{
+		ShopId:  id,
+		ActorId: &actorId,
+		To:      database.PENDING,
+		Reason:  input.Reason,
+	}
+
+	v := validator.New()
+	if database.ValidateApprovalEvent(v, event); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !ser.transitionShop(w, r, event) {
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"id": id, "approval_status": event.To, "event": event}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+// transitionShop applies the event and writes the error response if it fails.
+func (ser Server) transitionShop(w http.ResponseWriter, r *http.Request, event *database.ShopApprovalEvent) bool {
+	err := ser.models.Shops.Transition(event)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		case errors.Is(err, database.ErrInvalidTransition):
+			ser.conflictResponse(w, r, fmt.Sprintf("a %s shop can't be moved to %s", event.From, event.To))
+		case errors.Is(err, database.ErrShopClaimed):
+			ser.conflictResponse(w, r, "the shop is claimed by another reviewer")
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+	return true
+}
+
+// notifyShopReview emails the shop's creator about a reviewer's decision.
+func (ser Server) notifyShopReview(event *database.ShopApprovalEvent) {
+	go func() {
+		shop, err := ser.models.Shops.Get(event.ShopId, database.DefaultLocale)
+		if err != nil {
+			ser.logger.PrintError(err, nil)
+			return
+		}
+		creator, err := ser.models.Users.Get(int64(shop.Created_By))
+		if err != nil {
+			ser.logger.PrintError(err, nil)
+			return
+		}
+
+		data := map[string]interface{}{
+			"name":        creator.Name,
+			"shopID":      shop.Id,
+			"shopName":    shop.Name,
+			"approved":    event.To == database.APPROVED,
+			"reason":      event.Reason,
+			"frontendURL": ser.frontendURL,
+		}
+
+		if err = ser.mailer.Send(creator.Email, "shop_review.tmpl", data); err != nil {
+			ser.logger.PrintError(err, nil)
+		}
+	}()
+}
+
+func (ser Server) shopApprovalHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	shop, err := ser.models.Shops.Get(id, database.DefaultLocale)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Reviewer notes are only for the creator and staff.
+	if int64(shop.Created_By) != contextGetPrincipal(r).UserId {
+		granted, err := ser.can(r, database.PermissionShopsApprove)
+		if err == nil && !granted {
+			granted, err = ser.can(r, database.PermissionShopsWrite)
+		}
+		if err != nil {
+			ser.serverErrorResponse(w, r, err)
+			return
+		}
+		if !granted {
+			ser.forbiddenErrorResponse(w, r)
+			return
+		}
+	}
+
+	events, err := ser.models.Shops.ApprovalHistory(id)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"approval_history": events}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
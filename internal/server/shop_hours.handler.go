@@ -0,0 +1,210 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Mahider-T/autoSphere/internal/database"
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+// modifiableShop loads the shop in the {id} path wildcard and checks the
+// caller may change it. It writes the error response and returns false when
+// the handler should stop.
+func (ser Server) modifiableShop(w http.ResponseWriter, r *http.Request) (*database.Shop, bool) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	shop, err := ser.models.Shops.Get(id, database.DefaultLocale)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	allowed, err := ser.canModifyShop(r, shop)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	if !allowed {
+		ser.forbiddenErrorResponse(w, r)
+		return nil, false
+	}
+	return shop, true
+}
+
+func (ser Server) shopHoursGet(w http.ResponseWriter, r *http.Request) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	shop, err := ser.models.Shops.Get(id, database.DefaultLocale)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	visibility, err := ser.shopVisibility(r)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+	if !visibility.Allows(shop) {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	hours, err := ser.models.ShopHours.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"hours": hours}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+// shopHoursReplace sets the shop's timezone and weekly hours in one go. An
+// empty hours list means the shop has no regular opening hours.
+func (ser Server) shopHoursReplace(w http.ResponseWriter, r *http.Request) {
+	shop, ok := ser.modifiableShop(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Timezone string                     `json:"timezone"`
+		Hours    []database.OpeningInterval `json:"hours"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	hours := &database.ShopHours{Timezone: input.Timezone, Hours: input.Hours}
+	if hours.Hours == nil {
+		hours.Hours = []database.OpeningInterval{}
+	}
+
+	v := validator.New()
+	if database.ValidateShopHours(v, hours); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	id := int64(shop.Id)
+	if err := ser.models.ShopHours.Replace(id, hours); err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		case errors.Is(err, database.ErrUnknownTimezone):
+			v.AddError("timezone", "must be an IANA time zone such as Africa/Addis_Ababa")
+			ser.failedValidationResponse(w, r, v.Errors)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	hours, err := ser.models.ShopHours.Get(id)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"hours": hours}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) shopClosureCreate(w http.ResponseWriter, r *http.Request) {
+	shop, ok := ser.modifiableShop(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Starts_On string `json:"starts_on"`
+		Ends_On   string `json:"ends_on"`
+		Reason    string `json:"reason"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	closure := &database.ShopClosure{
+		Starts_On: input.Starts_On,
+		Ends_On:   input.Ends_On,
+		Reason:    input.Reason,
+	}
+
+	v := validator.New()
+	if database.ValidateShopClosure(v, closure); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := ser.models.ShopHours.AddClosure(int64(shop.Id), closure); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err := ser.writeJSON(w, http.StatusCreated, envelope{"closure": closure}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
+
+func (ser Server) shopClosureDelete(w http.ResponseWriter, r *http.Request) {
+	closureId, err := ser.readIntParam(r, "closureId")
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	shop, ok := ser.modifiableShop(w, r)
+	if !ok {
+		return
+	}
+
+	if err = ser.models.ShopHours.DeleteClosure(int64(shop.Id), closureId); err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = ser.writeJSON(w, http.StatusOK, envelope{"message": "closure successfully deleted"}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
+}
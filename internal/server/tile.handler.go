@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Mahider-T/autoSphere/validator"
+)
+
+const maxTileZoom = 22
+
+// shopTile serves /tiles/shops/{z}/{x}/{y}.mvt. The mux can't match a suffix
+// inside a wildcard, so the .mvt extension is stripped from {y} here.
+func (ser Server) shopTile(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	z, errZ := strconv.Atoi(r.PathValue("z"))
+	x, errX := strconv.Atoi(r.PathValue("x"))
+	y, errY := strconv.Atoi(strings.TrimSuffix(r.PathValue("y"), ".mvt"))
+
+	v.Check(errZ == nil && z >= 0 && z <= maxTileZoom, "z", "must be a zoom level between 0 and 22")
+	if v.Valid() {
+		tiles := 1 << z
+		v.Check(errX == nil && x >= 0 && x < tiles, "x", "must be a tile column at this zoom level")
+		v.Check(errY == nil && y >= 0 && y < tiles, "y", "must be a tile row at this zoom level")
+	}
+	if !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tile, err := ser.models.Shops.Tile(z, x, y)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.mapbox-vector-tile")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(tile)
+}
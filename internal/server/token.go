@@ -8,35 +8,35 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var secretKey = []byte("secret-key")
-
-func (ser Server) createToken(user database.User, ttl time.Duration) (string, error) {
-	// expirationTime := time.Now().Add(time.Hour * time.Duration(hourMultiplier))
-	// fmt.Println("Expires in : - - - ", time.Hour*hourMultiplier)
-	expirationTime := time.Now().Add(ttl)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"sub":  user.Id,
-			"role": user.Role,
-			"exp":  expirationTime.Unix(),
-		})
+const (
+	tokenTypeAccess       = "access"
+	tokenTypeMFAChallenge = "mfa_challenge"
+)
 
-	tokenString, err := token.SignedString(secretKey)
+// createToken signs a token of the given type for user. mfa records whether
+// the login that produced it passed the second factor. Permissions are
+// checked against the role id, which survives the role being renamed.
+func (ser Server) createToken(user database.User, ttl time.Duration, tokenType string, mfa bool) (string, error) {
+	roleId, err := ser.permissions.roleId(user.Role)
 	if err != nil {
 		return "", err
 	}
 
-	return tokenString, nil
-}
-func (ser Server) verifyToken(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Make sure the signing method is expected
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return secretKey, nil
+	expirationTime := time.Now().Add(ttl)
+	return ser.keys.sign(jwt.MapClaims{
+		"sub":  user.Id,
+		"role": user.Role,
+		"rid":  roleId,
+		"typ":  tokenType,
+		"mfa":  mfa,
+		"exp":  expirationTime.Unix(),
 	})
+}
 
+// verifyToken checks the signature and expiry and that the token is of the
+// expected type, so an MFA challenge can never be used as an access token.
+func (ser Server) verifyToken(tokenString string, tokenType string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, ser.keys.lookup)
 	if err != nil {
 		return nil, err
 	}
@@ -46,24 +46,12 @@ func (ser Server) verifyToken(tokenString string) (jwt.MapClaims, error) {
 	}
 
 	// Extract and return the claims if the token is valid
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		return claims, nil
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid claims")
 	}
-	return nil, fmt.Errorf("invalid claims")
+	if typ, _ := claims["typ"].(string); typ != tokenType {
+		return nil, fmt.Errorf("unexpected token type")
+	}
+	return claims, nil
 }
-
-// func (ser Server) verifyToken(tokenString string) error {
-// 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-// 		return secretKey, nil
-// 	})
-
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	if !token.Valid {
-// 		return fmt.Errorf("invalid token")
-// 	}
-
-// 	return nil
-// }
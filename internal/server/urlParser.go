@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Mahider-T/autoSphere/internal/database"
 	"github.com/Mahider-T/autoSphere/validator"
@@ -25,6 +26,105 @@ func (ser *Server) parseInt(r *http.Request, key string, defaultValue int, v *va
 	return val
 }
 
+func (ser *Server) parseFloat(r *http.Request, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := r.URL.Query().Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+	val, err := strconv.ParseFloat(s, 64)
+
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+
+	return val
+}
+
+// parseGeoPoint reads the lat and lng query parameters. Both must be given
+// together; nil means no point was requested.
+func (ser *Server) parseGeoPoint(r *http.Request, v *validator.Validator) *database.GeoPoint {
+	qs := r.URL.Query()
+	if qs.Get("lat") == "" && qs.Get("lng") == "" {
+		return nil
+	}
+
+	v.Check(qs.Get("lat") != "", "lat", "must be provided together with lng")
+	v.Check(qs.Get("lng") != "", "lng", "must be provided together with lat")
+
+	point := &database.GeoPoint{
+		Latitude:  ser.parseFloat(r, "lat", 0, v),
+		Longitude: ser.parseFloat(r, "lng", 0, v),
+	}
+	v.Check(point.Latitude >= -90 && point.Latitude <= 90, "lat", "must be between -90 and 90")
+	v.Check(point.Longitude >= -180 && point.Longitude <= 180, "lng", "must be between -180 and 180")
+	return point
+}
+
+// parseBoundingBox reads a "minLng,minLat,maxLng,maxLat" parameter. nil means
+// the parameter wasn't given.
+func (ser *Server) parseBoundingBox(r *http.Request, key string, v *validator.Validator) *database.BoundingBox {
+	s := r.URL.Query().Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		v.AddError(key, "must be minLng,minLat,maxLng,maxLat")
+		return nil
+	}
+
+	values := make([]float64, 4)
+	for i, part := range parts {
+		val, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			v.AddError(key, "must be minLng,minLat,maxLng,maxLat")
+			return nil
+		}
+		values[i] = val
+	}
+
+	bbox := &database.BoundingBox{MinLng: values[0], MinLat: values[1], MaxLng: values[2], MaxLat: values[3]}
+	database.ValidateBoundingBox(v, key, *bbox)
+	return bbox
+}
+
+func (ser *Server) parseBool(r *http.Request, key string, defaultValue bool, v *validator.Validator) bool {
+	s := r.URL.Query().Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+	val, err := strconv.ParseBool(s)
+
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return val
+}
+
+// parseTime reads an RFC 3339 timestamp. nil means the parameter wasn't given.
+func (ser *Server) parseTime(r *http.Request, key string, v *validator.Validator) *time.Time {
+	s := r.URL.Query().Get(key)
+
+	if s == "" {
+		return nil
+	}
+	val, err := time.Parse(time.RFC3339, s)
+
+	if err != nil {
+		v.AddError(key, "must be an RFC 3339 timestamp")
+		return nil
+	}
+
+	return &val
+}
+
 func (ser *Server) parseCSV(r *http.Request, key string, defaultValue []string) ([]string, error) {
 	csv := r.URL.Query().Get(key)
 
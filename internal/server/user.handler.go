@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/Mahider-T/autoSphere/internal/database"
@@ -58,6 +60,9 @@ func (ser *Server) userCreate(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, database.ErrDuplicatePhoneNumber):
 			v.AddError("phone number", "a user with this phone number already exists.")
 			ser.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, database.ErrUnknownRole):
+			v.AddError("role", "role does not exist")
+			ser.failedValidationResponse(w, r, v.Errors)
 		default:
 			ser.serverErrorResponse(w, r, err)
 		}
@@ -74,8 +79,8 @@ func (ser *Server) userCreate(w http.ResponseWriter, r *http.Request) {
 	go func() {
 
 		data := map[string]interface{}{
-			"userId":          user.Id,
-			"activationToken": token.Plaintext,
+			"userID":        user.Id,
+			"activationURL": ser.activationURL(token.Plaintext),
 		}
 		err = ser.mailer.Send(user.Email, "user_welcome.tmpl", data)
 		if err != nil {
@@ -163,11 +168,10 @@ func (ser Server) userPatch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input struct {
-		Name          *string        `json:"name"`
-		Email         *string        `json:"email"`
-		Phone_Number  *string        `json:"phone_number"`
-		Role          *database.Role `json:"role"`
-		Refresh_Token *string        `json:"refresh_token"`
+		Name         *string        `json:"name"`
+		Email        *string        `json:"email"`
+		Phone_Number *string        `json:"phone_number"`
+		Role         *database.Role `json:"role"`
 	}
 
 	err = ser.readJSON(w, r, &input)
@@ -189,15 +193,28 @@ func (ser Server) userPatch(w http.ResponseWriter, r *http.Request) {
 	if input.Role != nil {
 		user.Role = *input.Role
 	}
-	if input.Refresh_Token != nil {
-		user.Refresh_Token = input.Refresh_Token
-	}
 
-	//Todo : Validate the input here
+	v := validator.New()
+	if database.ValidateUser(v, user); !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 
 	err = ser.models.Users.Patch(user)
 	if err != nil {
-		ser.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, database.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email already exists.")
+			ser.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, database.ErrDuplicatePhoneNumber):
+			v.AddError("phone_number", "a user with this phone number already exists.")
+			ser.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, database.ErrUnknownRole):
+			v.AddError("role", "role does not exist")
+			ser.failedValidationResponse(w, r, v.Errors)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 	err = ser.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
@@ -265,16 +282,31 @@ func (ser Server) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	accountKey := database.AccountAttemptKey(input.Email)
+	ipKey := database.IPAttemptKey(clientIP(r))
+
+	lockedUntil, err := ser.models.LoginAttempts.LockedUntil(accountKey, ipKey)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		ser.tooManyLoginAttemptsResponse(w, r, time.Until(lockedUntil))
+		return
+	}
+
+	// Unknown emails and wrong passwords get the same response, in the same
+	// time, so callers can't enumerate accounts.
 	user, err := ser.models.Users.GetByEmail(input.Email)
 	if err != nil {
-		switch err {
-		case database.ErrRecordNotFound:
-			ser.notFoundResponse(w, r)
-			return
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			database.SimulatePasswordCheck(input.Password)
+			ser.loginFailed(w, r, accountKey, ipKey)
 		default:
 			ser.serverErrorResponse(w, r, err)
-			return
 		}
+		return
 	}
 
 	matches, err := user.Password.Matches(input.Password)
@@ -284,42 +316,104 @@ func (ser Server) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !matches {
-		ser.invalidCredentials(w, r)
+		ser.loginFailed(w, r, accountKey, ipKey)
 		return
 	}
 
-	v := validator.New()
+	if err = ser.models.LoginAttempts.Reset(accountKey); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !user.Is_Verified {
+		ser.accountNotActivatedResponse(w, r)
+		return
+	}
 
-	access_token, err := ser.createToken(user, 10*time.Minute)
+	if user.MFA_Enabled {
+		challenge, err := ser.createToken(user, 5*time.Minute, tokenTypeMFAChallenge, false)
+		if err != nil {
+			ser.serverErrorResponse(w, r, err)
+			return
+		}
+		ser.writeJSON(w, http.StatusOK, envelope{"mfa_required": true, "mfa_token": challenge}, nil)
+		return
+	}
+
+	ser.issueTokens(w, r, user, false)
+}
+
+// issueTokens starts a new session for user and responds with the access and
+// refresh token pair.
+func (ser Server) issueTokens(w http.ResponseWriter, r *http.Request, user database.User, mfa bool) {
+	access_token, err := ser.createToken(user, 10*time.Minute, tokenTypeAccess, mfa)
 	if err != nil {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
 
-	refresh_token, err := ser.createToken(user, 7*24*time.Hour)
+	session, err := ser.models.Sessions.New(user.Id, 7*24*time.Hour, r.UserAgent(), clientIP(r), mfa)
 	if err != nil {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
-	user.Refresh_Token = &refresh_token
 
-	err = ser.models.Users.Patch(&user)
+	response := envelope{"access_token": access_token, "refresh_token": session.Plaintext}
+	if !mfa {
+		required, err := ser.mfaRequired(0, user.Role)
+		if err != nil {
+			ser.serverErrorResponse(w, r, err)
+			return
+		}
+		if required {
+			response["mfa_enrollment_required"] = true
+		}
+	}
+	ser.writeJSON(w, http.StatusOK, response, nil)
+}
+
+func (ser Server) loginFailed(w http.ResponseWriter, r *http.Request, accountKey, ipKey string) {
+	if err := ser.recordLoginFailure(accountKey, ipKey); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+	ser.invalidCredentials(w, r)
+}
+
+func (ser Server) recordLoginFailure(accountKey, ipKey string) error {
+	if err := ser.models.LoginAttempts.RecordFailure(accountKey, database.AccountLockThreshold); err != nil {
+		return err
+	}
+	return ser.models.LoginAttempts.RecordFailure(ipKey, database.IPLockThreshold)
+}
+
+func (ser Server) userUnlock(w http.ResponseWriter, r *http.Request) {
+	id, err := ser.readIDParam(r)
+	if err != nil {
+		ser.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := ser.models.Users.Get(id)
 	if err != nil {
 		switch {
-		case errors.Is(err, database.ErrDuplicateEmail):
-			v.AddError("email", "a user with this email already exists.")
-			ser.failedValidationResponse(w, r, v.Errors)
-		case errors.Is(err, database.ErrDuplicatePhoneNumber):
-			v.AddError("phone number", "a user with this phone number already exists.")
-			ser.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.notFoundResponse(w, r)
 		default:
 			ser.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	ser.writeJSON(w, http.StatusOK, envelope{"access_token": access_token, "refresh_token": refresh_token}, nil)
+	if err = ser.models.LoginAttempts.Reset(database.AccountAttemptKey(user.Email)); err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
 
+	err = ser.writeJSON(w, http.StatusOK, envelope{"message": "account successfully unlocked"}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+	}
 }
 
 func (ser Server) refreshToken(w http.ResponseWriter, r *http.Request) {
@@ -331,27 +425,35 @@ func (ser Server) refreshToken(w http.ResponseWriter, r *http.Request) {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
-	user, err := ser.models.Users.GetByRefreshToken(input.Refresh_Token)
+
+	session, err := ser.models.Sessions.Rotate(input.Refresh_Token, 7*24*time.Hour, r.UserAgent(), clientIP(r))
 	if err != nil {
 		switch {
-		case errors.Is(err, database.ErrRecordNotFound):
-			ser.notFoundResponse(w, r)
+		case errors.Is(err, database.ErrRecordNotFound), errors.Is(err, database.ErrSessionReused):
+			ser.invalidRefreshTokenResponse(w, r)
 		default:
 			ser.serverErrorResponse(w, r, err)
 		}
 		return
 	}
-	_, err = ser.verifyToken(input.Refresh_Token)
+
+	user, err := ser.models.Users.Get(session.UserId)
 	if err != nil {
-		ser.authenticationRequiredResponse(w, r)
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.invalidRefreshTokenResponse(w, r)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
 		return
 	}
-	access_token, err := ser.createToken(*user, 10*time.Minute)
+
+	access_token, err := ser.createToken(*user, 10*time.Minute, tokenTypeAccess, session.MFA)
 	if err != nil {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
-	ser.writeJSON(w, http.StatusOK, envelope{"access_token": access_token}, nil)
+	ser.writeJSON(w, http.StatusOK, envelope{"access_token": access_token, "refresh_token": session.Plaintext}, nil)
 }
 
 func (ser Server) activate(w http.ResponseWriter, r *http.Request) {
@@ -366,9 +468,7 @@ func (ser Server) activate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hash := sha256.Sum256([]byte(input.PlainText))
-
-	user, err := ser.models.Users.GetToken(hash, database.ScopeActivation, time.Now())
+	user, err := ser.activateUser(input.PlainText)
 	if err != nil {
 		switch {
 		case errors.Is(err, database.ErrRecordNotFound):
@@ -380,25 +480,134 @@ func (ser Server) activate(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	user.Is_Verified = true
+	err = ser.writeJSON(w, http.StatusOK, envelope{"user_activation": user.Is_Verified}, nil)
+	if err != nil {
+		ser.serverErrorResponse(w, r, err)
+		return
+	}
+}
 
-	err = ser.models.Users.Patch(user)
+// activateUser marks the owner of an activation token as verified and burns
+// all of their activation tokens.
+func (ser Server) activateUser(plaintext string) (*database.User, error) {
+	hash := sha256.Sum256([]byte(plaintext))
 
+	user, err := ser.models.Users.GetToken(hash, database.ScopeActivation, time.Now())
 	if err != nil {
+		return nil, err
+	}
+
+	user.Is_Verified = true
+
+	if err = ser.models.Users.Patch(user); err != nil {
+		return nil, err
+	}
+
+	if err = ser.models.Tokens.DeleteAllForUser(database.ScopeActivation, user.Id); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// activateLink is the target of the link in activation emails. It activates
+// the account and redirects to the frontend's /activated page with a status
+// of success, invalid (unknown, used or expired token) or error.
+func (ser Server) activateLink(w http.ResponseWriter, r *http.Request) {
+	status := "success"
+
+	token := ser.parseString(r, "token", "")
+	if token == "" {
+		status = "invalid"
+	} else if _, err := ser.activateUser(token); err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			status = "invalid"
+		default:
+			// Not logError: the query string holds the token.
+			ser.logger.PrintError(err, map[string]string{
+				"request_method": r.Method,
+				"request_url":    r.URL.Path,
+			})
+			status = "error"
+		}
+	}
+
+	// The token is in the URL; keep it out of caches and Referer headers.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	http.Redirect(w, r, ser.frontendURL+"/activated?status="+status, http.StatusSeeOther)
+}
+
+// resendActivation issues a fresh activation token. The response is the same
+// whether or not the email belongs to an unactivated account.
+func (ser Server) resendActivation(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	if err := ser.readJSON(w, r, &input); err != nil {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
 
+	v := validator.New()
+	v.Check(input.Email != "", "email", "email must not be empty")
+	v.Check(validator.Matches(input.Email, validator.EmailRX), "email", "not a valid email")
+	if !v.Valid() {
+		ser.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !ser.activationLimiter.allow(strings.ToLower(input.Email)) {
+		ser.rateLimitExceededResponse(w, r)
+		return
+	}
+
+	message := envelope{"message": "if the account exists and is not yet activated, an email will be sent with activation instructions"}
+
+	user, err := ser.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRecordNotFound):
+			ser.writeJSON(w, http.StatusAccepted, message, nil)
+		default:
+			ser.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.Is_Verified {
+		ser.writeJSON(w, http.StatusAccepted, message, nil)
+		return
+	}
+
 	if err = ser.models.Tokens.DeleteAllForUser(database.ScopeActivation, user.Id); err != nil {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = ser.writeJSON(w, http.StatusOK, envelope{"user_activation": user.Is_Verified}, nil)
+	token, err := ser.models.Tokens.New(user.Id, 3*24*time.Hour, database.ScopeActivation)
 	if err != nil {
 		ser.serverErrorResponse(w, r, err)
 		return
 	}
+
+	go func() {
+		data := map[string]interface{}{
+			"activationURL": ser.activationURL(token.Plaintext),
+		}
+		err := ser.mailer.Send(user.Email, "user_activation.tmpl", data)
+		if err != nil {
+			ser.logger.PrintError(err, nil)
+		}
+	}()
+
+	ser.writeJSON(w, http.StatusAccepted, message, nil)
+}
+
+func (ser Server) activationURL(token string) string {
+	return ser.baseURL + "/users/activate?token=" + url.QueryEscape(token)
 }
 
 func (ser Server) forgotPassword(w http.ResponseWriter, r *http.Request) {
@@ -432,7 +641,7 @@ func (ser Server) forgotPassword(w http.ResponseWriter, r *http.Request) {
 	go func() {
 
 		data := map[string]interface{}{
-			"frontEndURL": "http://autosphere.com",
+			"frontendURL": ser.frontendURL,
 			"resetToken":  token.Plaintext,
 		}
 
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// A link without a token can't activate anything and is sent straight to the
+// frontend; a server without any models can handle it.
+func TestActivateLinkWithoutToken(t *testing.T) {
+	ser := Server{frontendURL: "https://autosphere.example"}
+
+	req := httptest.NewRequest(http.MethodGet, "/users/activate", nil)
+	rr := httptest.NewRecorder()
+	ser.activateLink(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status %d, got %d", http.StatusSeeOther, rr.Code)
+	}
+	if got, want := rr.Header().Get("Location"), "https://autosphere.example/activated?status=invalid"; got != want {
+		t.Errorf("expected redirect to %s, got %s", want, got)
+	}
+	if rr.Header().Get("Cache-Control") != "no-store" {
+		t.Error("expected the response not to be cached")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
 )
@@ -68,13 +69,27 @@ func (ser *Server) writeJSON(w http.ResponseWriter, status int, data envelope, h
 }
 
 func (ser *Server) readIDParam(r *http.Request) (int64, error) {
+	return ser.readIntParam(r, "id")
+}
+
+// readIntParam reads a positive integer path wildcard such as {keyId}.
+func (ser *Server) readIntParam(r *http.Request, name string) (int64, error) {
 	// params := httprouter.ParamsFromContext(r.Context())
 	// id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
-	idParam := r.PathValue("id")
+	idParam := r.PathValue(name)
 
 	id, err := strconv.ParseInt(idParam, 10, 32)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
+
+// clientIP returns the remote address of the request without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
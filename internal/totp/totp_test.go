@@ -0,0 +1,108 @@
+package totp
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 test vectors from RFC 6238 appendix B. The RFC lists 8 digit
+// codes; a 6 digit code is the same value modulo 10^6.
+var rfcSecret = []byte("12345678901234567890")
+
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	for _, tt := range rfcVectors {
+		got := code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if got != tt.code {
+			t.Errorf("code at %d: expected %s, got %s", tt.unix, tt.code, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name     string
+		input    string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", code(rfcSecret, current), 0, current, true},
+		{"one step behind", code(rfcSecret, current-1), 0, current - 1, true},
+		{"one step ahead", code(rfcSecret, current+1), 0, current + 1, true},
+		{"two steps behind", code(rfcSecret, current-2), 0, 0, false},
+		{"two steps ahead", code(rfcSecret, current+2), 0, 0, false},
+		{"replayed step", code(rfcSecret, current), current, 0, false},
+		{"step before last used", code(rfcSecret, current-1), current - 1, 0, false},
+		{"later step after last used", code(rfcSecret, current+1), current, current + 1, true},
+		{"wrong code", "000000", 0, 0, false},
+		{"empty code", "", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.input, now, tt.lastStep)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("expected (%d, %t), got (%d, %t)", tt.wantStep, tt.wantOK, step, ok)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+
+	if len(a) != 20 {
+		t.Errorf("expected a 160-bit secret, got %d bytes", len(a))
+	}
+	if bytes.Equal(a, b) {
+		t.Error("expected two secrets to differ")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("AutoSphere", "user@example.com", rfcSecret)
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", uri, err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("unexpected scheme or type in %s", uri)
+	}
+	if !strings.HasSuffix(u.Path, "AutoSphere:user@example.com") {
+		t.Errorf("unexpected label in %s", uri)
+	}
+
+	q := u.Query()
+	if q.Get("secret") != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Errorf("unexpected secret %s", q.Get("secret"))
+	}
+	if q.Get("digits") != "6" || q.Get("period") != "30" || q.Get("algorithm") != "SHA1" {
+		t.Errorf("unexpected parameters %s", u.RawQuery)
+	}
+}
@@ -0,0 +1,9 @@
+-- key is "email:<address>" for per-account tracking or "ip:<address>" for
+-- per-client tracking. Emails are tracked even when no account exists so that
+-- lockouts do not reveal which addresses are registered.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMP(0) WITH TIME ZONE
+);
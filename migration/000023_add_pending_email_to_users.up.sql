@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN pending_email CITEXT;
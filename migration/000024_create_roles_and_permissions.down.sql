@@ -0,0 +1,7 @@
+CREATE TYPE role AS ENUM ('ADMIN', 'OPERATOR', 'SALES');
+ALTER TABLE users DROP CONSTRAINT users_role_fkey;
+ALTER TABLE users ALTER COLUMN role TYPE role USING role::role;
+
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id SERIAL PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('ADMIN', 'Full access, including user and role management'),
+    ('OPERATOR', 'Manages shops and the category catalogue'),
+    ('SALES', 'Submits shops');
+
+INSERT INTO permissions (code, description) VALUES
+    ('users:read', 'View user accounts'),
+    ('users:write', 'Create, edit and unlock user accounts'),
+    ('users:delete', 'Delete user accounts'),
+    ('sessions:manage', 'Revoke other users'' sessions'),
+    ('api_keys:manage', 'Create, list and revoke API keys'),
+    ('roles:manage', 'Manage roles and their permissions'),
+    ('shops:create', 'Submit new shops'),
+    ('shops:write', 'Edit and delete any shop'),
+    ('shops:approve', 'Approve or decline shops'),
+    ('categories:write', 'Manage categories, category members and shop categories'),
+    ('files:write', 'Upload, fetch and delete files');
+
+-- Seed the three fixed roles with the access they had before.
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles CROSS JOIN permissions
+WHERE roles.name = 'ADMIN'
+   OR (roles.name = 'OPERATOR' AND permissions.code IN ('shops:create', 'shops:write', 'categories:write', 'files:write'))
+   OR (roles.name = 'SALES' AND permissions.code IN ('shops:create', 'files:write'));
+
+ALTER TABLE users ALTER COLUMN role TYPE TEXT USING role::text;
+ALTER TABLE users ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
+DROP TYPE role;
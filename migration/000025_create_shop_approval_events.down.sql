@@ -0,0 +1 @@
+DROP TABLE IF EXISTS shop_approval_events;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS shop_approval_events (
+    id BIGSERIAL PRIMARY KEY,
+    shop_id INTEGER NOT NULL REFERENCES shops(id) ON DELETE CASCADE,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    from_status approval_status NOT NULL,
+    to_status approval_status NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS shop_approval_events_shop_id_idx ON shop_approval_events (shop_id, created_at);
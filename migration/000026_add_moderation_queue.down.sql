@@ -0,0 +1,9 @@
+DELETE FROM role_permissions
+USING roles, permissions
+WHERE role_permissions.role_id = roles.id AND role_permissions.permission_id = permissions.id
+AND roles.name = 'OPERATOR' AND permissions.code = 'shops:approve';
+
+DROP INDEX IF EXISTS shops_moderation_queue_idx;
+ALTER TABLE shops DROP COLUMN IF EXISTS claimed_until;
+ALTER TABLE shops DROP COLUMN IF EXISTS claimed_by;
+ALTER TABLE shops DROP COLUMN IF EXISTS submitted_at;
@@ -0,0 +1,13 @@
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS submitted_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW();
+UPDATE shops SET submitted_at = created_at WHERE created_at IS NOT NULL;
+
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS claimed_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS shops_moderation_queue_idx ON shops (submitted_at) WHERE approval_status = 'PENDING';
+
+-- Operators work the moderation queue.
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'OPERATOR' AND permissions.code = 'shops:approve'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS shop_closures;
+DROP TABLE IF EXISTS shop_hours;
+ALTER TABLE shops DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,27 @@
+-- Opening hours are stored in the shop's local time.
+ALTER TABLE shops ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'Africa/Addis_Ababa';
+
+-- weekday follows EXTRACT(DOW): 0 is Sunday. A day may have several
+-- intervals; closes_at may be 24:00 for shops open until midnight.
+CREATE TABLE IF NOT EXISTS shop_hours (
+    id BIGSERIAL PRIMARY KEY,
+    shop_id INTEGER NOT NULL REFERENCES shops(id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    opens_at TIME NOT NULL,
+    closes_at TIME NOT NULL,
+    CHECK (opens_at < closes_at)
+);
+
+CREATE INDEX IF NOT EXISTS shop_hours_shop_id_idx ON shop_hours (shop_id, weekday);
+
+-- Whole-day closures such as holidays, inclusive of both dates.
+CREATE TABLE IF NOT EXISTS shop_closures (
+    id BIGSERIAL PRIMARY KEY,
+    shop_id INTEGER NOT NULL REFERENCES shops(id) ON DELETE CASCADE,
+    starts_on DATE NOT NULL,
+    ends_on DATE NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    CHECK (starts_on <= ends_on)
+);
+
+CREATE INDEX IF NOT EXISTS shop_closures_shop_id_idx ON shop_closures (shop_id, ends_on);
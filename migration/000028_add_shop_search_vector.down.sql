@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS shops_name_trgm_idx;
+DROP INDEX IF EXISTS shops_search_vector_idx;
+
+DROP TRIGGER IF EXISTS category_members_search_vector_update ON category_members;
+DROP TRIGGER IF EXISTS shop_categories_search_vector_update ON shop_categories;
+DROP TRIGGER IF EXISTS shops_search_vector_update ON shops;
+
+DROP FUNCTION IF EXISTS category_members_search_vector_trigger();
+DROP FUNCTION IF EXISTS shop_categories_search_vector_trigger();
+DROP FUNCTION IF EXISTS shops_search_vector_trigger();
+DROP FUNCTION IF EXISTS shop_search_vector(INTEGER, TEXT, TEXT);
+
+ALTER TABLE shops DROP COLUMN IF EXISTS search_vector;
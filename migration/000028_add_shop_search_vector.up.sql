@@ -0,0 +1,67 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE shops ADD COLUMN search_vector tsvector NOT NULL DEFAULT '';
+
+-- Name weighs most, then the shop's category values, then the free text
+-- location. Category values live in other tables, so the column is kept up to
+-- date by triggers rather than being a generated column.
+CREATE OR REPLACE FUNCTION shop_search_vector(p_shop_id INTEGER, p_name TEXT, p_location TEXT)
+RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('simple', coalesce(p_name, '')), 'A')
+        || setweight(to_tsvector('simple', coalesce((
+            SELECT string_agg(category_members.value, ' ')
+            FROM shop_categories
+            INNER JOIN category_members ON shop_categories.category_member_id = category_members.id
+            WHERE shop_categories.shop_id = p_shop_id
+        ), '')), 'B')
+        || setweight(to_tsvector('simple', coalesce(p_location, '')), 'C');
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION shops_search_vector_trigger() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := shop_search_vector(NEW.id, NEW.name, NEW.location);
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER shops_search_vector_update
+BEFORE INSERT OR UPDATE OF name, location ON shops
+FOR EACH ROW EXECUTE FUNCTION shops_search_vector_trigger();
+
+CREATE OR REPLACE FUNCTION shop_categories_search_vector_trigger() RETURNS trigger AS $$
+DECLARE
+    changed_shop_id INTEGER;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed_shop_id := OLD.shop_id;
+    ELSE
+        changed_shop_id := NEW.shop_id;
+    END IF;
+
+    UPDATE shops SET search_vector = shop_search_vector(id, name, location)
+    WHERE id = changed_shop_id;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER shop_categories_search_vector_update
+AFTER INSERT OR UPDATE OR DELETE ON shop_categories
+FOR EACH ROW EXECUTE FUNCTION shop_categories_search_vector_trigger();
+
+-- Renaming a category value changes the vector of every shop carrying it.
+CREATE OR REPLACE FUNCTION category_members_search_vector_trigger() RETURNS trigger AS $$
+BEGIN
+    UPDATE shops SET search_vector = shop_search_vector(id, name, location)
+    WHERE id IN (SELECT shop_id FROM shop_categories WHERE category_member_id = NEW.id);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER category_members_search_vector_update
+AFTER UPDATE OF value ON category_members
+FOR EACH ROW EXECUTE FUNCTION category_members_search_vector_trigger();
+
+UPDATE shops SET search_vector = shop_search_vector(id, name, location);
+
+CREATE INDEX IF NOT EXISTS shops_search_vector_idx ON shops USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS shops_name_trgm_idx ON shops USING GIN (name gin_trgm_ops);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS category_members_value_trgm_idx;
+DROP INDEX IF EXISTS shops_location_trgm_idx;
+DROP INDEX IF EXISTS category_members_value_prefix_idx;
+DROP INDEX IF EXISTS shops_location_prefix_idx;
+DROP INDEX IF EXISTS shops_name_prefix_idx;
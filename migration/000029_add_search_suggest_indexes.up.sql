@@ -0,0 +1,9 @@
+-- Prefix matches for autocomplete. text_pattern_ops lets LIKE 'abc%' use the
+-- index whatever the database collation.
+CREATE INDEX IF NOT EXISTS shops_name_prefix_idx ON shops (lower(name) text_pattern_ops) WHERE approval_status = 'APPROVED';
+CREATE INDEX IF NOT EXISTS shops_location_prefix_idx ON shops (lower(location) text_pattern_ops) WHERE approval_status = 'APPROVED';
+CREATE INDEX IF NOT EXISTS category_members_value_prefix_idx ON category_members (lower(value) text_pattern_ops);
+
+-- Trigram matches for misspellings. shops_name_trgm_idx already exists.
+CREATE INDEX IF NOT EXISTS shops_location_trgm_idx ON shops USING GIN (location gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS category_members_value_trgm_idx ON category_members USING GIN (value gin_trgm_ops);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS categories_parent_id_idx;
+DROP INDEX IF EXISTS categories_path_idx;
+
+ALTER TABLE categories DROP COLUMN IF EXISTS path;
+ALTER TABLE categories DROP COLUMN IF EXISTS parent_id;
+
+DROP EXTENSION IF EXISTS ltree;
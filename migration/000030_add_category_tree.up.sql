@@ -0,0 +1,14 @@
+CREATE EXTENSION IF NOT EXISTS ltree;
+
+-- path is the chain of ids from the root down to the category itself, e.g.
+-- 1.4.9 for Parts > Engine > Filters. It is kept in step with parent_id by the
+-- application when categories are created or moved.
+ALTER TABLE categories ADD COLUMN parent_id INTEGER REFERENCES categories(id) ON DELETE RESTRICT;
+ALTER TABLE categories ADD COLUMN path ltree;
+
+UPDATE categories SET path = text2ltree(id::text);
+
+ALTER TABLE categories ALTER COLUMN path SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS categories_path_idx ON categories USING GIST (path);
+CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id);
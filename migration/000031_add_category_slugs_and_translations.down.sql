@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS category_member_translations;
+DROP TABLE IF EXISTS category_translations;
+
+ALTER TABLE category_members DROP COLUMN IF EXISTS slug;
+ALTER TABLE categories DROP COLUMN IF EXISTS slug;
@@ -0,0 +1,35 @@
+-- Slugs are stable, URL safe identifiers for filtering; value stays the
+-- default label. Existing rows get a slug derived from their value, falling
+-- back to the id where the value has no ASCII letters or digits or the slug is
+-- already taken.
+ALTER TABLE categories ADD COLUMN slug TEXT;
+UPDATE categories SET slug = trim(both '-' from regexp_replace(lower(value), '[^a-z0-9]+', '-', 'g'));
+UPDATE categories SET slug = 'category-' || id WHERE slug = '';
+UPDATE categories SET slug = slug || '-' || id
+WHERE EXISTS (SELECT 1 FROM categories other WHERE other.slug = categories.slug AND other.id < categories.id);
+ALTER TABLE categories ALTER COLUMN slug SET NOT NULL;
+ALTER TABLE categories ADD CONSTRAINT categories_slug_key UNIQUE (slug);
+ALTER TABLE categories ADD CONSTRAINT categories_slug_check CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$');
+
+ALTER TABLE category_members ADD COLUMN slug TEXT;
+UPDATE category_members SET slug = trim(both '-' from regexp_replace(lower(value), '[^a-z0-9]+', '-', 'g'));
+UPDATE category_members SET slug = 'value-' || id WHERE slug = '';
+UPDATE category_members SET slug = slug || '-' || id
+WHERE EXISTS (SELECT 1 FROM category_members other WHERE other.slug = category_members.slug AND other.id < category_members.id);
+ALTER TABLE category_members ALTER COLUMN slug SET NOT NULL;
+ALTER TABLE category_members ADD CONSTRAINT category_members_slug_key UNIQUE (slug);
+ALTER TABLE category_members ADD CONSTRAINT category_members_slug_check CHECK (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$');
+
+CREATE TABLE IF NOT EXISTS category_translations (
+    category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    locale TEXT NOT NULL,
+    label TEXT NOT NULL,
+    PRIMARY KEY (category_id, locale)
+);
+
+CREATE TABLE IF NOT EXISTS category_member_translations (
+    category_member_id INTEGER NOT NULL REFERENCES category_members(id) ON DELETE CASCADE,
+    locale TEXT NOT NULL,
+    label TEXT NOT NULL,
+    PRIMARY KEY (category_member_id, locale)
+);
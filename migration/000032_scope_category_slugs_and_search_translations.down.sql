@@ -0,0 +1,27 @@
+DROP INDEX IF EXISTS category_member_translations_label_trgm_idx;
+DROP INDEX IF EXISTS category_member_translations_label_prefix_idx;
+
+DROP TRIGGER IF EXISTS category_member_translations_search_vector_update ON category_member_translations;
+DROP FUNCTION IF EXISTS category_member_translations_search_vector_trigger();
+
+CREATE OR REPLACE FUNCTION shop_search_vector(p_shop_id INTEGER, p_name TEXT, p_location TEXT)
+RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('simple', coalesce(p_name, '')), 'A')
+        || setweight(to_tsvector('simple', coalesce((
+            SELECT string_agg(category_members.value, ' ')
+            FROM shop_categories
+            INNER JOIN category_members ON shop_categories.category_member_id = category_members.id
+            WHERE shop_categories.shop_id = p_shop_id
+        ), '')), 'B')
+        || setweight(to_tsvector('simple', coalesce(p_location, '')), 'C');
+$$ LANGUAGE sql STABLE;
+
+UPDATE shops SET search_vector = shop_search_vector(id, name, location);
+
+-- Restoring the global constraints fails if rows now share a slug or value.
+DROP INDEX IF EXISTS category_members_slug_idx;
+ALTER TABLE category_members DROP CONSTRAINT IF EXISTS category_members_category_id_slug_key;
+ALTER TABLE category_members ADD CONSTRAINT category_members_slug_key UNIQUE (slug);
+
+ALTER TABLE category_members ADD CONSTRAINT category_members_value_key UNIQUE (value);
+ALTER TABLE categories ADD CONSTRAINT categories_value_key UNIQUE (value);
@@ -0,0 +1,55 @@
+-- Values are only default labels now that slugs identify categories and
+-- their members, so two of them may share one.
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_value_key;
+ALTER TABLE category_members DROP CONSTRAINT IF EXISTS category_members_value_key;
+
+-- Member slugs only need to be unique within their category, so brand:other
+-- and service:other can coexist. Filters still look members up by slug alone.
+ALTER TABLE category_members DROP CONSTRAINT IF EXISTS category_members_slug_key;
+ALTER TABLE category_members ADD CONSTRAINT category_members_category_id_slug_key UNIQUE (category_id, slug);
+CREATE INDEX IF NOT EXISTS category_members_slug_idx ON category_members (slug);
+
+-- Translated labels are searchable alongside the default value.
+CREATE OR REPLACE FUNCTION shop_search_vector(p_shop_id INTEGER, p_name TEXT, p_location TEXT)
+RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('simple', coalesce(p_name, '')), 'A')
+        || setweight(to_tsvector('simple', coalesce((
+            SELECT string_agg(labels.label, ' ')
+            FROM shop_categories
+            INNER JOIN category_members ON shop_categories.category_member_id = category_members.id
+            CROSS JOIN LATERAL (
+                SELECT category_members.value AS label
+                UNION ALL
+                SELECT label FROM category_member_translations
+                WHERE category_member_translations.category_member_id = category_members.id
+            ) AS labels
+            WHERE shop_categories.shop_id = p_shop_id
+        ), '')), 'B')
+        || setweight(to_tsvector('simple', coalesce(p_location, '')), 'C');
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION category_member_translations_search_vector_trigger() RETURNS trigger AS $$
+DECLARE
+    changed_member_id INTEGER;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed_member_id := OLD.category_member_id;
+    ELSE
+        changed_member_id := NEW.category_member_id;
+    END IF;
+
+    UPDATE shops SET search_vector = shop_search_vector(id, name, location)
+    WHERE id IN (SELECT shop_id FROM shop_categories WHERE category_member_id = changed_member_id);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER category_member_translations_search_vector_update
+AFTER INSERT OR UPDATE OR DELETE ON category_member_translations
+FOR EACH ROW EXECUTE FUNCTION category_member_translations_search_vector_trigger();
+
+UPDATE shops SET search_vector = shop_search_vector(id, name, location);
+
+-- Autocomplete matches translated labels too.
+CREATE INDEX IF NOT EXISTS category_member_translations_label_prefix_idx ON category_member_translations (lower(label) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS category_member_translations_label_trgm_idx ON category_member_translations USING GIN (label gin_trgm_ops);
@@ -0,0 +1,4 @@
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS mfa_required BOOLEAN NOT NULL DEFAULT false;
+
+-- The roles MFA_REQUIRED_ROLES defaulted to.
+UPDATE roles SET mfa_required = true WHERE name IN ('ADMIN', 'OPERATOR');
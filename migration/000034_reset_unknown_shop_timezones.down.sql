@@ -0,0 +1 @@
+-- The names replaced by the up migration were unusable and aren't restored.
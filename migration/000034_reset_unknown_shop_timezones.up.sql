@@ -0,0 +1,4 @@
+-- Names Go accepts but Postgres doesn't, such as 'Local', break AT TIME ZONE
+-- in the opening hours filters for every shop.
+UPDATE shops SET timezone = 'Africa/Addis_Ababa'
+WHERE timezone NOT IN (SELECT name FROM pg_timezone_names);